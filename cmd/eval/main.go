@@ -0,0 +1,156 @@
+// Command eval indexes the corpus into a scratch database with the configured
+// embedder, scores retrieval for a set of golden questions, and exits non-zero
+// if it regressed past the saved baseline.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jcserv/portfolio-api/internal"
+	"github.com/jcserv/portfolio-api/internal/db"
+	"github.com/jcserv/portfolio-api/internal/eval"
+	"github.com/jcserv/portfolio-api/internal/rag"
+	"github.com/jcserv/portfolio-api/internal/utils"
+	"github.com/jcserv/portfolio-api/internal/utils/log"
+	"go.uber.org/zap"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run evaluates retrieval and returns the exit code, so deferred cleanup runs
+// before the process exits.
+func run() int {
+	goldenPath := flag.String("golden", "eval/golden.json", "golden questions and the documents expected for each")
+	baselinePath := flag.String("baseline", "eval/baseline.json", "saved metrics to compare against")
+	k := flag.Int("k", 0, "number of documents to score, defaults to TOP_K")
+	tolerance := flag.Float64("tolerance", 0.01, "how far a metric may fall below the baseline")
+	updateBaseline := flag.Bool("update-baseline", false, "save the results as the baseline")
+	verbose := flag.Bool("v", false, "print the results of each question")
+	flag.Parse()
+
+	ctx := context.Background()
+	logger := log.GetLogger(ctx)
+	defer logger.Sync()
+
+	cfg, err := internal.NewConfiguration()
+	if err != nil {
+		logger.Error("could not load configuration", zap.Error(err))
+		return 1
+	}
+	if *k == 0 {
+		*k = cfg.TopK
+	}
+
+	golden, err := eval.ReadGolden(*goldenPath)
+	if err != nil {
+		logger.Error("could not read golden questions", zap.Error(err))
+		return 1
+	}
+
+	corpus, err := index(ctx, cfg)
+	if corpus != nil {
+		defer os.RemoveAll(corpus.dir)
+	}
+	if err != nil {
+		logger.Error("could not index corpus", zap.Error(err))
+		return 1
+	}
+
+	results, err := eval.Run(ctx, corpus.db, corpus.embedder, golden, *k)
+	if err != nil {
+		logger.Error("could not evaluate retrieval", zap.Error(err))
+		return 1
+	}
+	mean := eval.Mean(results)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if *verbose {
+		fmt.Fprintln(w, "question\trecall@k\tmrr\tndcg\tretrieved")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%.4f\t%.4f\t%.4f\t%s\n", r.Question.Question, r.Metrics.RecallAtK, r.Metrics.MRR, r.Metrics.NDCG, strings.Join(r.Retrieved, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+	model := corpus.embedder.EmbeddingModel()
+	fmt.Fprintf(w, "embedding model\t%s\nquestions\t%d\nk\t%d\nrecall@k\t%.4f\nmrr\t%.4f\nndcg\t%.4f\n",
+		model, len(results), *k, mean.RecallAtK, mean.MRR, mean.NDCG)
+	w.Flush()
+
+	baseline, err := eval.ReadBaseline(*baselinePath)
+	if err != nil {
+		logger.Error("could not read baseline", zap.Error(err))
+		return 1
+	}
+
+	if *updateBaseline {
+		baseline[model] = eval.BaselineEntry{K: *k, Metrics: mean}
+		if err := eval.WriteBaseline(*baselinePath, baseline); err != nil {
+			logger.Error("could not write baseline", zap.Error(err))
+			return 1
+		}
+		fmt.Printf("saved baseline for %s to %s\n", model, *baselinePath)
+		return 0
+	}
+
+	saved, ok := baseline[model]
+	if !ok || saved.K != *k {
+		fmt.Printf("no baseline for %s with k=%d, run with -update-baseline to save one\n", model, *k)
+		return 0
+	}
+	if regressions := mean.Regressions(saved.Metrics, *tolerance); len(regressions) > 0 {
+		fmt.Printf("retrieval regressed past the baseline: %s\n", strings.Join(regressions, ", "))
+		return 1
+	}
+	fmt.Println("retrieval is within the baseline")
+	return 0
+}
+
+// indexedCorpus is the corpus embedded into a scratch database in dir.
+type indexedCorpus struct {
+	dir      string
+	db       *db.LibSQL
+	embedder rag.EmbeddingProvider
+}
+
+// index embeds the corpus into a scratch database, so evaluation does not
+// touch the service's index. The returned corpus should be removed even if
+// indexing fails.
+func index(ctx context.Context, cfg *internal.Configuration) (*indexedCorpus, error) {
+	embedder, chat, err := internal.NewProviders(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "portfolio-api-eval")
+	if err != nil {
+		return nil, err
+	}
+	corpus := &indexedCorpus{dir: dir, embedder: embedder}
+
+	corpus.db, err = db.NewLibSQL(ctx, filepath.Join(dir, "eval.db"))
+	if err != nil {
+		return corpus, err
+	}
+	service := rag.NewService(corpus.db, embedder, chat, nil, nil, rag.Config{})
+
+	exp, err := utils.ReadExperience()
+	if err != nil {
+		return corpus, err
+	}
+	projs, err := utils.ReadProjects()
+	if err != nil {
+		return corpus, err
+	}
+	if _, err := service.IndexCorpus(ctx, exp, projs); err != nil {
+		return corpus, err
+	}
+	return corpus, nil
+}
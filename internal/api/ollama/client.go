@@ -0,0 +1,245 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/errors"
+)
+
+const DefaultBaseURL = "http://localhost:11434"
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	maxRetries int
+}
+
+func NewClient(baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{},
+		maxRetries: 5,
+	}
+}
+
+type Message struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+type ToolCall struct {
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+// Tool describes a function the model may call. Parameters is a JSON schema.
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters"`
+}
+
+type Options struct {
+	Temperature *float32 `json:"temperature,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+}
+
+type ChatRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Tools    []Tool    `json:"tools,omitempty"`
+	Stream   bool      `json:"stream"`
+	Format   string    `json:"format,omitempty"`
+	Options  *Options  `json:"options,omitempty"`
+}
+
+type ChatResponse struct {
+	Model           string  `json:"model"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	DoneReason      string  `json:"done_reason,omitempty"`
+	PromptEvalCount int     `json:"prompt_eval_count,omitempty"`
+	EvalCount       int     `json:"eval_count,omitempty"`
+}
+
+type EmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type EmbedResponse struct {
+	Model      string      `json:"model"`
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+type APIError struct {
+	StatusCode int
+	Message    string `json:"error"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("ollama: status %d: %s", e.StatusCode, e.Message)
+}
+
+func (c *Client) newBackOff(ctx context.Context) backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 1 * time.Second
+	b.MaxInterval = 30 * time.Second
+	b.MaxElapsedTime = time.Duration(c.maxRetries) * 30 * time.Second
+	return backoff.WithContext(b, ctx)
+}
+
+// post sends body to path, retrying while the server is busy or still loading
+// the model. The caller must close the returned response body.
+func (c *Client) post(ctx context.Context, path string, body any) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *http.Response
+	operation := func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(payload))
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		r, err := c.httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return backoff.Permanent(err)
+			}
+			return err
+		}
+
+		if r.StatusCode != http.StatusOK {
+			defer r.Body.Close()
+			apiErr := &APIError{StatusCode: r.StatusCode}
+			if err := json.NewDecoder(r.Body).Decode(apiErr); err != nil {
+				apiErr.Message = http.StatusText(r.StatusCode)
+			}
+			if r.StatusCode == http.StatusTooManyRequests || r.StatusCode == http.StatusServiceUnavailable {
+				return apiErr
+			}
+			return backoff.Permanent(apiErr)
+		}
+
+		resp = r
+		return nil
+	}
+
+	if err := backoff.Retry(operation, c.newBackOff(ctx)); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) Embed(ctx context.Context, request EmbedRequest) (EmbedResponse, error) {
+	resp, err := c.post(ctx, "/api/embed", request)
+	if err != nil {
+		return EmbedResponse{}, errors.Wrap(err, "failed to create embedding")
+	}
+	defer resp.Body.Close()
+
+	var response EmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return EmbedResponse{}, errors.Wrap(err, "failed to decode embedding")
+	}
+	return response, nil
+}
+
+func (c *Client) Chat(ctx context.Context, request ChatRequest) (ChatResponse, error) {
+	request.Stream = false
+	resp, err := c.post(ctx, "/api/chat", request)
+	if err != nil {
+		return ChatResponse{}, errors.Wrap(err, "failed to create chat completion")
+	}
+	defer resp.Body.Close()
+
+	var response ChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return ChatResponse{}, errors.Wrap(err, "failed to decode chat completion")
+	}
+	return response, nil
+}
+
+// ChatStream reads the newline-delimited JSON chunks of a streaming chat.
+type ChatStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	done    bool
+}
+
+// ChatStream opens a streaming chat. The caller must Close the returned
+// stream.
+func (c *Client) ChatStream(ctx context.Context, request ChatRequest) (*ChatStream, error) {
+	request.Stream = true
+	resp, err := c.post(ctx, "/api/chat", request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create chat completion stream")
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &ChatStream{body: resp.Body, scanner: scanner}, nil
+}
+
+// Recv returns the next chunk of the stream, or io.EOF once the final chunk
+// has been returned.
+func (s *ChatStream) Recv() (ChatResponse, error) {
+	if s.done {
+		return ChatResponse{}, io.EOF
+	}
+
+	for s.scanner.Scan() {
+		line := bytes.TrimSpace(s.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk struct {
+			ChatResponse
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return ChatResponse{}, errors.Wrap(err, "failed to decode chat completion chunk")
+		}
+		if chunk.Error != "" {
+			return ChatResponse{}, errors.New(chunk.Error)
+		}
+		s.done = chunk.Done
+		return chunk.ChatResponse, nil
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		return ChatResponse{}, err
+	}
+	return ChatResponse{}, io.ErrUnexpectedEOF
+}
+
+func (s *ChatStream) Close() error {
+	return s.body.Close()
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/jcserv/portfolio-api/internal/utils/tokenizer"
 	"github.com/pkg/errors"
 	"github.com/sashabaranov/go-openai"
 )
@@ -18,8 +19,20 @@ type Client struct {
 }
 
 func NewClient(apiKey string) *Client {
+	return NewClientWithConfig(openai.DefaultConfig(apiKey))
+}
+
+// NewClientWithBaseURL creates a client for an OpenAI-compatible API served at
+// baseURL, e.g. http://localhost:11434/v1 for Ollama.
+func NewClientWithBaseURL(apiKey, baseURL string) *Client {
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = baseURL
+	return NewClientWithConfig(config)
+}
+
+func NewClientWithConfig(config openai.ClientConfig) *Client {
 	return &Client{
-		client: openai.NewClient(apiKey),
+		client: openai.NewClientWithConfig(config),
 		rateLimits: openai.RateLimitHeaders{
 			LimitRequests:     60,     // Default
 			LimitTokens:       150000, // Default
@@ -75,16 +88,59 @@ func (c *Client) waitForCapacity(ctx context.Context, tokensNeeded int) error {
 	return nil
 }
 
-func (c *Client) CreateEmbedding(ctx context.Context, request openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
-	var response openai.EmbeddingResponse
+func (c *Client) newBackOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 2 * time.Second
+	b.MaxInterval = 60 * time.Second
+	b.MaxElapsedTime = time.Duration(c.maxRetries) * 60 * time.Second
+	return b
+}
+
+// countChatTokens returns the tokens a chat completion can use: its prompt and
+// the most it may generate.
+func countChatTokens(request openai.ChatCompletionRequest) int {
+	var tokensNeeded int
+	if t, err := tokenizer.ForModel(request.Model); err == nil {
+		tokensNeeded = t.CountMessages(request.Messages)
+	} else {
+		// Rough estimate: 4 chars per token
+		for _, msg := range request.Messages {
+			tokensNeeded += len(msg.Content) / 4
+		}
+	}
 
-	// Estimate tokens needed (rough estimation)
+	if request.MaxTokens > 0 {
+		tokensNeeded += request.MaxTokens
+	} else {
+		tokensNeeded *= 2 // Default buffer if max_tokens not specified
+	}
+	return tokensNeeded
+}
+
+// countEmbeddingTokens returns the tokens used to embed a request's input.
+func countEmbeddingTokens(request openai.EmbeddingRequest) int {
+	texts, ok := request.Input.([]string)
+	if !ok {
+		return 0
+	}
+
+	t, err := tokenizer.ForModel(string(request.Model))
 	tokensNeeded := 0
-	if texts, ok := request.Input.([]string); ok {
-		for _, text := range texts {
+	for _, text := range texts {
+		if err != nil {
 			tokensNeeded += len(text) / 4 // Rough estimate: 4 chars per token
+			continue
 		}
+		tokensNeeded += t.Count(text)
 	}
+	return tokensNeeded
+}
+
+func (c *Client) CreateEmbedding(ctx context.Context, request openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	var response openai.EmbeddingResponse
+
+	tokensNeeded := countEmbeddingTokens(request)
+
 	operation := func() error {
 		if err := c.waitForCapacity(ctx, tokensNeeded); err != nil {
 			return backoff.Permanent(err)
@@ -109,12 +165,7 @@ func (c *Client) CreateEmbedding(ctx context.Context, request openai.EmbeddingRe
 		return nil
 	}
 
-	b := backoff.NewExponentialBackOff()
-	b.InitialInterval = 2 * time.Second
-	b.MaxInterval = 60 * time.Second
-	b.MaxElapsedTime = time.Duration(c.maxRetries) * 60 * time.Second
-
-	err := backoff.Retry(operation, b)
+	err := backoff.Retry(operation, c.newBackOff())
 	if err != nil {
 		return openai.EmbeddingResponse{}, errors.Wrap(err, "failed to create embedding")
 	}
@@ -125,17 +176,7 @@ func (c *Client) CreateEmbedding(ctx context.Context, request openai.EmbeddingRe
 func (c *Client) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
 	var response openai.ChatCompletionResponse
 
-	// Estimate tokens needed from messages
-	tokensNeeded := 0
-	for _, msg := range request.Messages {
-		tokensNeeded += len(msg.Content) / 4
-	}
-
-	if request.MaxTokens > 0 {
-		tokensNeeded += request.MaxTokens
-	} else {
-		tokensNeeded *= 2 // Default buffer if max_tokens not specified
-	}
+	tokensNeeded := countChatTokens(request)
 
 	operation := func() error {
 		if err := c.waitForCapacity(ctx, tokensNeeded); err != nil {
@@ -161,15 +202,82 @@ func (c *Client) CreateChatCompletion(ctx context.Context, request openai.ChatCo
 		return nil
 	}
 
-	b := backoff.NewExponentialBackOff()
-	b.InitialInterval = 2 * time.Second
-	b.MaxInterval = 60 * time.Second
-	b.MaxElapsedTime = time.Duration(c.maxRetries) * 60 * time.Second
-
-	err := backoff.Retry(operation, b)
+	err := backoff.Retry(operation, c.newBackOff())
 	if err != nil {
 		return openai.ChatCompletionResponse{}, errors.Wrap(err, "failed to create chat completion")
 	}
 
 	return response, nil
 }
+
+func (c *Client) CreateModeration(ctx context.Context, request openai.ModerationRequest) (openai.ModerationResponse, error) {
+	var response openai.ModerationResponse
+
+	operation := func() error {
+		if err := c.waitForCapacity(ctx, 0); err != nil {
+			return backoff.Permanent(err)
+		}
+
+		resp, err := c.client.Moderations(ctx, request)
+		if err != nil {
+			if apiErr, ok := err.(*openai.APIError); ok {
+				headers := resp.GetRateLimitHeaders()
+				c.updateRateLimits(headers)
+				if apiErr.HTTPStatusCode == 429 {
+					return err
+				}
+				return backoff.Permanent(err)
+			}
+			return backoff.Permanent(err)
+		}
+
+		headers := resp.GetRateLimitHeaders()
+		c.updateRateLimits(headers)
+		response = resp
+		return nil
+	}
+
+	err := backoff.Retry(operation, backoff.WithContext(c.newBackOff(), ctx))
+	if err != nil {
+		return openai.ModerationResponse{}, errors.Wrap(err, "failed to create moderation")
+	}
+
+	return response, nil
+}
+
+// CreateChatCompletionStream opens a streaming chat completion. Retries only
+// apply to establishing the stream; once it is returned the caller owns it and
+// must Close it.
+func (c *Client) CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (*openai.ChatCompletionStream, error) {
+	var stream *openai.ChatCompletionStream
+
+	tokensNeeded := countChatTokens(request)
+
+	operation := func() error {
+		if err := c.waitForCapacity(ctx, tokensNeeded); err != nil {
+			return backoff.Permanent(err)
+		}
+
+		s, err := c.client.CreateChatCompletionStream(ctx, request)
+		if err != nil {
+			if apiErr, ok := err.(*openai.APIError); ok {
+				if apiErr.HTTPStatusCode == 429 {
+					return err
+				}
+				return backoff.Permanent(err)
+			}
+			return backoff.Permanent(err)
+		}
+
+		c.updateRateLimits(s.GetRateLimitHeaders())
+		stream = s
+		return nil
+	}
+
+	err := backoff.Retry(operation, backoff.WithContext(c.newBackOff(), ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create chat completion stream")
+	}
+
+	return stream, nil
+}
@@ -2,7 +2,10 @@ package internal
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/jcserv/portfolio-api/internal/api/ollama"
+	"github.com/jcserv/portfolio-api/internal/rag"
 	"github.com/jcserv/portfolio-api/internal/utils/env"
 )
 
@@ -12,6 +15,71 @@ type Configuration struct {
 	HTTPPort    string
 	DBPath      string
 	OpenAIKey   string
+	AdminToken  string
+
+	LLMProvider    string
+	OpenAIBaseURL  string
+	OllamaBaseURL  string
+	ChatModel      string
+	EmbeddingModel string
+
+	ConversationTTL          time.Duration
+	ConversationHistoryLimit int
+
+	RetrievalMode string
+	LexicalWeight float64
+	RRFK          int
+
+	MMR       bool
+	MMRLambda float64
+
+	Reranker         string
+	RerankCandidates int
+
+	QueryRewrite    bool
+	QueryHyDE       bool
+	QueryExpansions int
+
+	AnswerCache          bool
+	AnswerCacheThreshold float64
+
+	MinSimilarity      float64
+	OutOfScopeResponse string
+
+	AllowedChatModels   []string
+	TopK                int
+	MaxTopK             int
+	Temperature         float64
+	MaxTokens           int
+	MaxCompletionTokens int
+
+	OwnerName      string
+	PromptTemplate string
+
+	InjectionDetection  bool
+	InjectionClassifier bool
+	InjectionAction     string
+
+	Moderation                string
+	RedactContactInfo         bool
+	ContactAllowlist          []string
+	MaxAnswerLength           int
+	GuardrailFallbackResponse string
+
+	ContextTokenBudget int
+
+	StructuredAnswers       bool
+	StructuredAnswerRetries int
+
+	SuggestionCount int
+
+	ToolCalling       bool
+	MaxToolIterations int
+
+	LanguageDetection bool
+	QueryTranslation  bool
+
+	FilterDetection bool
 }
 
 func NewConfiguration() (*Configuration, error) {
@@ -21,6 +89,177 @@ func NewConfiguration() (*Configuration, error) {
 	cfg.HTTPPort = env.GetString("HTTP_PORT", "8080")
 	cfg.DBPath = env.GetString("DB_PATH", "./internal/db/portfolio-api.db")
 	cfg.OpenAIKey = env.GetString("OPENAI_API_KEY", "")
+	cfg.AdminToken = env.GetString("ADMIN_TOKEN", "")
+
+	cfg.LLMProvider = env.GetString("LLM_PROVIDER", rag.ProviderOpenAI)
+	cfg.OpenAIBaseURL = env.GetString("OPENAI_BASE_URL", "")
+	cfg.OllamaBaseURL = env.GetString("OLLAMA_BASE_URL", ollama.DefaultBaseURL)
+	switch cfg.LLMProvider {
+	case rag.ProviderLocal:
+		cfg.ChatModel = rag.LocalChatModel
+		cfg.EmbeddingModel = rag.LocalEmbeddingModel
+	case rag.ProviderOllama:
+		cfg.ChatModel = env.GetString("CHAT_MODEL", rag.DefaultOllamaChatModel)
+		cfg.EmbeddingModel = env.GetString("EMBEDDING_MODEL", rag.DefaultOllamaEmbeddingModel)
+	default:
+		cfg.ChatModel = env.GetString("CHAT_MODEL", rag.DefaultOpenAIChatModel)
+		cfg.EmbeddingModel = env.GetString("EMBEDDING_MODEL", rag.DefaultOpenAIEmbeddingModel)
+	}
+
+	var err error
+	cfg.ConversationTTL, err = env.GetDuration("CONVERSATION_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ConversationHistoryLimit, err = env.GetInt("CONVERSATION_HISTORY_LIMIT", 6)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.RetrievalMode = env.GetString("RETRIEVAL_MODE", rag.RetrievalModeHybrid)
+	cfg.LexicalWeight, err = env.GetFloat("LEXICAL_WEIGHT", 0.5)
+	if err != nil {
+		return nil, err
+	}
+	cfg.RRFK, err = env.GetInt("RRF_K", 60)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.MMR, err = env.GetBool("MMR", false)
+	if err != nil {
+		return nil, err
+	}
+	cfg.MMRLambda, err = env.GetFloat("MMR_LAMBDA", 0.7)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Reranker = env.GetString("RERANKER", rag.RerankerNone)
+	cfg.RerankCandidates, err = env.GetInt("RERANK_CANDIDATES", 10)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.QueryRewrite, err = env.GetBool("QUERY_REWRITE", false)
+	if err != nil {
+		return nil, err
+	}
+	cfg.QueryHyDE, err = env.GetBool("QUERY_HYDE", false)
+	if err != nil {
+		return nil, err
+	}
+	cfg.QueryExpansions, err = env.GetInt("QUERY_EXPANSIONS", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.AnswerCache, err = env.GetBool("ANSWER_CACHE", true)
+	if err != nil {
+		return nil, err
+	}
+	cfg.AnswerCacheThreshold, err = env.GetFloat("ANSWER_CACHE_THRESHOLD", 0.95)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.MinSimilarity, err = env.GetFloat("MIN_SIMILARITY", 0.2)
+	if err != nil {
+		return nil, err
+	}
+	cfg.OutOfScopeResponse = env.GetString("OUT_OF_SCOPE_RESPONSE",
+		"Sorry, I can only answer questions about Jarrod's professional experience and projects.")
+
+	cfg.AllowedChatModels = env.GetStringSlice("ALLOWED_CHAT_MODELS", []string{cfg.ChatModel})
+	cfg.TopK, err = env.GetInt("TOP_K", 3)
+	if err != nil {
+		return nil, err
+	}
+	cfg.MaxTopK, err = env.GetInt("MAX_TOP_K", 10)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Temperature, err = env.GetFloat("TEMPERATURE", 1)
+	if err != nil {
+		return nil, err
+	}
+	cfg.MaxTokens, err = env.GetInt("MAX_TOKENS", 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg.MaxCompletionTokens, err = env.GetInt("MAX_COMPLETION_TOKENS", 1024)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ContextTokenBudget, err = env.GetInt("CONTEXT_TOKEN_BUDGET", 1500)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.StructuredAnswers, err = env.GetBool("STRUCTURED_ANSWERS", true)
+	if err != nil {
+		return nil, err
+	}
+	cfg.StructuredAnswerRetries, err = env.GetInt("STRUCTURED_ANSWER_RETRIES", 2)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.SuggestionCount, err = env.GetInt("SUGGESTION_COUNT", 6)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.ToolCalling, err = env.GetBool("TOOL_CALLING", true)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.MaxToolIterations, err = env.GetInt("MAX_TOOL_ITERATIONS", 3)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.LanguageDetection, err = env.GetBool("LANGUAGE_DETECTION", true)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.QueryTranslation, err = env.GetBool("QUERY_TRANSLATION", true)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.FilterDetection, err = env.GetBool("FILTER_DETECTION", true)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.OwnerName = env.GetString("OWNER_NAME", "Jarrod")
+	cfg.PromptTemplate = env.GetString("PROMPT_TEMPLATE", "")
+
+	cfg.InjectionDetection, err = env.GetBool("INJECTION_DETECTION", true)
+	if err != nil {
+		return nil, err
+	}
+	cfg.InjectionClassifier, err = env.GetBool("INJECTION_CLASSIFIER", false)
+	if err != nil {
+		return nil, err
+	}
+	cfg.InjectionAction = env.GetString("INJECTION_ACTION", rag.InjectionActionReject)
+
+	cfg.Moderation = env.GetString("MODERATION", rag.ModerationNone)
+	cfg.RedactContactInfo, err = env.GetBool("REDACT_CONTACT_INFO", true)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ContactAllowlist = env.GetStringSlice("CONTACT_ALLOWLIST", nil)
+	cfg.MaxAnswerLength, err = env.GetInt("MAX_ANSWER_LENGTH", 4000)
+	if err != nil {
+		return nil, err
+	}
+	cfg.GuardrailFallbackResponse = env.GetString("GUARDRAIL_FALLBACK_RESPONSE",
+		"Sorry, I can't share that. Try asking about Jarrod's experience or projects in a different way.")
 
 	if err := cfg.Validate(); err != nil {
 		return nil, err
@@ -35,12 +274,102 @@ func (c *Configuration) Validate() error {
 		c.Environment,
 		c.HTTPPort,
 		c.DBPath,
-		c.OpenAIKey,
+		c.ChatModel,
+		c.EmbeddingModel,
+		c.OutOfScopeResponse,
+		c.OwnerName,
+		c.GuardrailFallbackResponse,
 	}
 	for i, v := range variables {
 		if v == "" {
 			return fmt.Errorf("missing required variable: %d", i)
 		}
 	}
+	switch c.LLMProvider {
+	case rag.ProviderOpenAI:
+		if c.OpenAIKey == "" && c.OpenAIBaseURL == "" {
+			return fmt.Errorf("missing required variable: OPENAI_API_KEY")
+		}
+	case rag.ProviderOllama:
+		if c.OllamaBaseURL == "" {
+			return fmt.Errorf("missing required variable: OLLAMA_BASE_URL")
+		}
+	case rag.ProviderLocal:
+	default:
+		return fmt.Errorf("unknown llm provider: %s", c.LLMProvider)
+	}
+	if c.ConversationTTL <= 0 {
+		return fmt.Errorf("conversation ttl must be positive")
+	}
+	if c.ConversationHistoryLimit < 0 {
+		return fmt.Errorf("conversation history limit must not be negative")
+	}
+	if c.RetrievalMode != rag.RetrievalModeVector && c.RetrievalMode != rag.RetrievalModeHybrid {
+		return fmt.Errorf("unknown retrieval mode: %s", c.RetrievalMode)
+	}
+	if c.LexicalWeight < 0 || c.LexicalWeight > 1 {
+		return fmt.Errorf("lexical weight must be between 0 and 1")
+	}
+	if c.RRFK <= 0 {
+		return fmt.Errorf("rrf k must be positive")
+	}
+	if c.MMRLambda < 0 || c.MMRLambda > 1 {
+		return fmt.Errorf("mmr lambda must be between 0 and 1")
+	}
+	switch c.Reranker {
+	case rag.RerankerNone, rag.RerankerLexical, rag.RerankerLLM:
+	default:
+		return fmt.Errorf("unknown reranker: %s", c.Reranker)
+	}
+	if c.RerankCandidates <= 0 {
+		return fmt.Errorf("rerank candidates must be positive")
+	}
+	if c.QueryExpansions < 0 {
+		return fmt.Errorf("query expansions must not be negative")
+	}
+	if c.MinSimilarity < 0 || c.MinSimilarity > 1 {
+		return fmt.Errorf("min similarity must be between 0 and 1")
+	}
+	if c.TopK < 1 || c.TopK > c.MaxTopK {
+		return fmt.Errorf("top k must be between 1 and max top k")
+	}
+	if c.Temperature < 0 || c.Temperature > 2 {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if c.MaxTokens < 0 || c.MaxTokens > c.MaxCompletionTokens {
+		return fmt.Errorf("max tokens must be between 0 and max completion tokens")
+	}
+	if c.ContextTokenBudget < 0 {
+		return fmt.Errorf("context token budget must not be negative")
+	}
+	if c.StructuredAnswerRetries < 0 {
+		return fmt.Errorf("structured answer retries must not be negative")
+	}
+	if c.SuggestionCount < 0 {
+		return fmt.Errorf("suggestion count must not be negative")
+	}
+	if c.ToolCalling && c.MaxToolIterations < 1 {
+		return fmt.Errorf("max tool iterations must be at least 1")
+	}
+	switch c.InjectionAction {
+	case rag.InjectionActionReject, rag.InjectionActionSanitize:
+	default:
+		return fmt.Errorf("unknown injection action: %s", c.InjectionAction)
+	}
+	switch c.Moderation {
+	case rag.ModerationNone, rag.ModerationLLM:
+	case rag.ModerationOpenAI:
+		if c.LLMProvider != rag.ProviderOpenAI {
+			return fmt.Errorf("openai moderation requires the openai llm provider")
+		}
+	default:
+		return fmt.Errorf("unknown moderation: %s", c.Moderation)
+	}
+	if c.MaxAnswerLength < 0 {
+		return fmt.Errorf("max answer length must not be negative")
+	}
+	if c.AnswerCacheThreshold <= 0 || c.AnswerCacheThreshold > 1 {
+		return fmt.Errorf("answer cache threshold must be in (0, 1]")
+	}
 	return nil
 }
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/jcserv/portfolio-api/internal/utils"
+	"github.com/pkg/errors"
+)
+
+const corpusVersionKey = "corpus_version"
+
+// ComputeCorpusVersion hashes the content of every indexed document along with
+// the embedding model and prompt version, so it changes whenever the index or
+// the prompt does.
+func (l *LibSQL) ComputeCorpusVersion(ctx context.Context, embeddingModel, promptVersion string) (string, error) {
+	hashes, err := l.documentHashes(ctx)
+	if err != nil {
+		return "", err
+	}
+	return utils.HashContent(strings.Join(append([]string{embeddingModel, promptVersion}, hashes...), "\n")), nil
+}
+
+// SetCorpusVersion records the current corpus version, clearing the answer
+// cache if it changed. It reports whether the version changed.
+func (l *LibSQL) SetCorpusVersion(ctx context.Context, version string) (bool, error) {
+	current, ok, err := l.GetMetadata(ctx, corpusVersionKey)
+	if err != nil {
+		return false, err
+	}
+	if ok && current == version {
+		return false, nil
+	}
+
+	if _, err := l.db.ExecContext(ctx, "DELETE FROM answer_cache"); err != nil {
+		return false, errors.Wrap(err, "failed to clear answer cache")
+	}
+	return true, l.SetMetadata(ctx, corpusVersionKey, version)
+}
+
+func (l *LibSQL) StoreCachedAnswer(ctx context.Context, questionEmbedding []float32, answer model.CachedAnswer) error {
+	sourcesJSON, err := json.Marshal(answer.Sources)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode sources")
+	}
+	followUpsJSON, err := json.Marshal(answer.FollowUpQuestions)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode follow-up questions")
+	}
+	entitiesJSON, err := json.Marshal(answer.Entities)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode entities")
+	}
+
+	_, err = l.db.ExecContext(ctx, `
+		INSERT INTO answer_cache (question, question_embedding, answer, follow_up_questions, entities, sources, language, corpus_version)
+		SELECT ?, ?, ?, ?, ?, ?, ?, value FROM metadata WHERE key = ?
+	`, answer.Question, utils.Float32SliceToBytes(questionEmbedding), answer.Answer,
+		string(followUpsJSON), string(entitiesJSON), string(sourcesJSON), answer.Language, corpusVersionKey)
+	return errors.Wrap(err, "failed to store cached answer")
+}
+
+// FindCachedAnswer returns the cached answer to the question most similar to
+// the one given, if its similarity is at least threshold. Only answers in the
+// given language for the current corpus version are considered.
+func (l *LibSQL) FindCachedAnswer(ctx context.Context, questionEmbedding []float32, threshold float64, language string) (*model.CachedAnswer, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT id, question, question_embedding, answer, follow_up_questions, entities, sources
+		FROM answer_cache
+		WHERE corpus_version = (SELECT value FROM metadata WHERE key = ?) AND language = ?
+	`, corpusVersionKey, language)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query answer cache")
+	}
+	defer rows.Close()
+
+	var best *model.CachedAnswer
+	var bestFollowUps, bestEntities, bestSources string
+	for rows.Next() {
+		cached := model.CachedAnswer{Language: language}
+		var embeddingBlob []byte
+		var followUps, entities, sources string
+		if err := rows.Scan(&cached.ID, &cached.Question, &embeddingBlob, &cached.Answer, &followUps, &entities, &sources); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+
+		cached.Similarity = calculateCosineSimilarity(questionEmbedding, utils.BytesToFloat32Slice(embeddingBlob))
+		if cached.Similarity < threshold || (best != nil && cached.Similarity <= best.Similarity) {
+			continue
+		}
+		best = &cached
+		bestFollowUps, bestEntities, bestSources = followUps, entities, sources
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if best == nil {
+		return nil, nil
+	}
+
+	if err := json.Unmarshal([]byte(bestSources), &best.Sources); err != nil {
+		return nil, errors.Wrap(err, "failed to decode cached sources")
+	}
+	if err := json.Unmarshal([]byte(bestFollowUps), &best.FollowUpQuestions); err != nil {
+		return nil, errors.Wrap(err, "failed to decode cached follow-up questions")
+	}
+	if err := json.Unmarshal([]byte(bestEntities), &best.Entities); err != nil {
+		return nil, errors.Wrap(err, "failed to decode cached entities")
+	}
+	return best, nil
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/pkg/errors"
+)
+
+func (l *LibSQL) CreateConversation(ctx context.Context) (string, error) {
+	id := uuid.NewString()
+	_, err := l.db.ExecContext(ctx, "INSERT INTO conversations (id) VALUES (?)", id)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create conversation")
+	}
+	return id, nil
+}
+
+// IsConversationActive reports whether the conversation exists and has been
+// used within the ttl.
+func (l *LibSQL) IsConversationActive(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM conversations WHERE id = ? AND updated_at > datetime('now', ?))`
+
+	var active bool
+	err := l.db.QueryRowContext(ctx, query, id, ttlModifier(ttl)).Scan(&active)
+	if err != nil {
+		return false, fmt.Errorf("checking conversation: %w", err)
+	}
+	return active, nil
+}
+
+// GetConversationTurns returns the most recent limit turns of a conversation,
+// oldest first.
+func (l *LibSQL) GetConversationTurns(ctx context.Context, id string, limit int) ([]model.Turn, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT role, content FROM (
+			SELECT id, role, content
+			FROM conversation_turns
+			WHERE conversation_id = ?
+			ORDER BY id DESC
+			LIMIT ?
+		) ORDER BY id ASC
+	`, id, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query conversation turns")
+	}
+	defer rows.Close()
+
+	var turns []model.Turn
+	for rows.Next() {
+		var turn model.Turn
+		if err := rows.Scan(&turn.Role, &turn.Content); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		turns = append(turns, turn)
+	}
+	return turns, rows.Err()
+}
+
+func (l *LibSQL) AppendConversationTurns(ctx context.Context, id string, turns ...model.Turn) error {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	for _, turn := range turns {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO conversation_turns (conversation_id, role, content) VALUES (?, ?, ?)",
+			id, turn.Role, turn.Content,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to store conversation turn")
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	if err != nil {
+		return errors.Wrap(err, "failed to touch conversation")
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to commit conversation turns")
+}
+
+// DeleteExpiredConversations removes conversations, and their turns, that
+// have not been used within the ttl.
+func (l *LibSQL) DeleteExpiredConversations(ctx context.Context, ttl time.Duration) (int64, error) {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	modifier := ttlModifier(ttl)
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM conversation_turns WHERE conversation_id IN (
+			SELECT id FROM conversations WHERE updated_at <= datetime('now', ?)
+		)
+	`, modifier)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to delete expired conversation turns")
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM conversations WHERE updated_at <= datetime('now', ?)", modifier)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to delete expired conversations")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "failed to commit expired conversations")
+	}
+	return res.RowsAffected()
+}
+
+func ttlModifier(ttl time.Duration) string {
+	return fmt.Sprintf("-%d seconds", int64(ttl.Seconds()))
+}
@@ -0,0 +1,198 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/jcserv/portfolio-api/internal/utils"
+	"github.com/pkg/errors"
+)
+
+// IndexedDocument is a document along with its embedded chunks.
+type IndexedDocument struct {
+	Document model.Document
+	Chunks   []model.Chunk
+}
+
+// SyncDocuments applies the changes that reconcile the index with the corpus
+// in a single transaction. Documents in add are inserted, documents in update
+// replace the document with the same id along with its embeddings, and the
+// documents with ids in remove are deleted along with their embeddings.
+func (l *LibSQL) SyncDocuments(ctx context.Context, add, update []IndexedDocument, remove []int64) error {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	for _, id := range remove {
+		if err := deleteDocument(ctx, tx, id); err != nil {
+			return err
+		}
+	}
+
+	for _, doc := range update {
+		techJSON, err := encodeTech(doc.Document.Tech)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE documents
+			SET category = ?, title = ?, text = ?, content_hash = ?, tech = ?, workplace = ?, source_key = ?
+			WHERE id = ?
+		`, doc.Document.Category, doc.Document.Title, doc.Document.Text, utils.HashContent(doc.Document.Text),
+			techJSON, doc.Document.Workplace, doc.Document.SourceKey, doc.Document.ID)
+		if err != nil {
+			return errors.Wrap(err, "failed to update document")
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM embeddings WHERE parent_id = ?", doc.Document.ID); err != nil {
+			return errors.Wrap(err, "failed to delete embeddings")
+		}
+		if err := insertChunks(ctx, tx, doc.Document, doc.Document.ID, doc.Chunks); err != nil {
+			return err
+		}
+	}
+
+	for _, doc := range add {
+		techJSON, err := encodeTech(doc.Document.Tech)
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO documents (category, title, text, content_hash, tech, workplace, source_key) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			doc.Document.Category, doc.Document.Title, doc.Document.Text, utils.HashContent(doc.Document.Text),
+			techJSON, doc.Document.Workplace, doc.Document.SourceKey,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to store document")
+		}
+		parentID, err := res.LastInsertId()
+		if err != nil {
+			return errors.Wrap(err, "failed to get document id")
+		}
+		if err := insertChunks(ctx, tx, doc.Document, parentID, doc.Chunks); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to commit index changes")
+}
+
+func deleteDocument(ctx context.Context, tx *sql.Tx, id int64) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM embeddings WHERE parent_id = ?", id); err != nil {
+		return errors.Wrap(err, "failed to delete embeddings")
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM documents WHERE id = ?", id); err != nil {
+		return errors.Wrap(err, "failed to delete document")
+	}
+	return nil
+}
+
+func insertChunks(ctx context.Context, tx *sql.Tx, doc model.Document, parentID int64, chunks []model.Chunk) error {
+	for _, chunk := range chunks {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO embeddings (text, embedding_blob, content_hash, category, title, parent_id) VALUES (?, ?, ?, ?, ?, ?)",
+			chunk.Text, utils.Float32SliceToBytes(chunk.Embedding), utils.HashContent(chunk.Text), doc.Category, doc.Title, parentID,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to store embedding")
+		}
+	}
+	return nil
+}
+
+func encodeTech(tech []string) (string, error) {
+	if tech == nil {
+		tech = []string{}
+	}
+	techJSON, err := json.Marshal(tech)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode tech")
+	}
+	return string(techJSON), nil
+}
+
+// GetDocuments returns the documents with the given ids, keyed by id.
+func (l *LibSQL) GetDocuments(ctx context.Context, ids []int64) (map[int64]model.Document, error) {
+	docs := make(map[int64]model.Document, len(ids))
+	if len(ids) == 0 {
+		return docs, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := make([]any, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	rows, err := l.db.QueryContext(ctx,
+		"SELECT id, category, title, text FROM documents WHERE id IN ("+placeholders+")", args...,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query documents")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var doc model.Document
+		if err := rows.Scan(&doc.ID, &doc.Category, &doc.Title, &doc.Text); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		docs[doc.ID] = doc
+	}
+	return docs, rows.Err()
+}
+
+// ListDocuments returns every indexed document.
+func (l *LibSQL) ListDocuments(ctx context.Context) ([]model.Document, error) {
+	rows, err := l.db.QueryContext(ctx, "SELECT id, category, title, text, tech, workplace, source_key FROM documents ORDER BY id")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query documents")
+	}
+	defer rows.Close()
+
+	var docs []model.Document
+	for rows.Next() {
+		var doc model.Document
+		var tech string
+		if err := rows.Scan(&doc.ID, &doc.Category, &doc.Title, &doc.Text, &tech, &doc.Workplace, &doc.SourceKey); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		if err := json.Unmarshal([]byte(tech), &doc.Tech); err != nil {
+			return nil, errors.Wrap(err, "failed to decode tech")
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// ComputeContentHash hashes the content of every indexed document, so it
+// changes whenever a document is added, removed or edited.
+func (l *LibSQL) ComputeContentHash(ctx context.Context) (string, error) {
+	hashes, err := l.documentHashes(ctx)
+	if err != nil {
+		return "", err
+	}
+	return utils.HashContent(strings.Join(hashes, "\n")), nil
+}
+
+func (l *LibSQL) documentHashes(ctx context.Context) ([]string, error) {
+	rows, err := l.db.QueryContext(ctx, "SELECT content_hash FROM documents ORDER BY content_hash")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query documents")
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/pkg/errors"
+)
+
+// StoreAnswer records an answer and returns the ID it was assigned.
+func (l *LibSQL) StoreAnswer(ctx context.Context, answer model.Answer) (string, error) {
+	sourcesJSON, err := json.Marshal(answer.Sources)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode sources")
+	}
+
+	id := uuid.NewString()
+	_, err = l.db.ExecContext(ctx, `
+		INSERT INTO answers (id, conversation_id, question, answer, sources, prompt_version)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, id, answer.ConversationID, answer.Question, answer.Answer, string(sourcesJSON), answer.PromptVersion)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to store answer")
+	}
+	return id, nil
+}
+
+// StoreFeedback records a rating of an answer, replacing any earlier rating
+// of it. It reports whether the answer exists.
+func (l *LibSQL) StoreFeedback(ctx context.Context, answerID, rating, comment string) (bool, error) {
+	result, err := l.db.ExecContext(ctx, `
+		INSERT INTO feedback (answer_id, rating, comment)
+		SELECT id, ?, ? FROM answers WHERE id = ?
+		ON CONFLICT (answer_id) DO UPDATE SET
+			rating = excluded.rating,
+			comment = excluded.comment,
+			created_at = CURRENT_TIMESTAMP
+	`, rating, comment, answerID)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to store feedback")
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to store feedback")
+	}
+	return n > 0, nil
+}
+
+// ListFeedback returns the most recent limit ratings of the given kind, along
+// with the answers they rate.
+func (l *LibSQL) ListFeedback(ctx context.Context, rating string, limit int) ([]model.Feedback, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT f.id, f.rating, f.comment, f.created_at,
+			a.id, a.conversation_id, a.question, a.answer, a.sources, a.prompt_version, a.created_at
+		FROM feedback f
+		JOIN answers a ON a.id = f.answer_id
+		WHERE f.rating = ?
+		ORDER BY f.created_at DESC, f.id DESC
+		LIMIT ?
+	`, rating, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query feedback")
+	}
+	defer rows.Close()
+
+	feedback := []model.Feedback{}
+	for rows.Next() {
+		var f model.Feedback
+		var sources string
+		if err := rows.Scan(&f.ID, &f.Rating, &f.Comment, &f.CreatedAt,
+			&f.Answer.ID, &f.Answer.ConversationID, &f.Answer.Question, &f.Answer.Answer,
+			&sources, &f.Answer.PromptVersion, &f.Answer.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		if err := json.Unmarshal([]byte(sources), &f.Answer.Sources); err != nil {
+			return nil, errors.Wrap(err, "failed to decode sources")
+		}
+		feedback = append(feedback, f)
+	}
+	return feedback, rows.Err()
+}
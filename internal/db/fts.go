@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/pkg/errors"
+)
+
+var ftsTokenRegex = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// FindLexical ranks the chunks of documents matching filter by BM25 against
+// the terms in query. Higher scores are better.
+func (l *LibSQL) FindLexical(ctx context.Context, query string, limit int, filter model.SearchFilter) ([]model.SearchResult, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+
+	where, filterArgs := filterClause(filter)
+	args := append([]any{match}, filterArgs...)
+	args = append(args, limit)
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT e.id, COALESCE(e.parent_id, 0), e.text, e.category, e.title, -bm25(embeddings_fts) AS score
+		FROM embeddings_fts
+		JOIN embeddings e ON e.id = embeddings_fts.rowid
+		JOIN documents d ON d.id = e.parent_id
+		WHERE embeddings_fts MATCH ? AND `+where+`
+		ORDER BY score DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query fts table")
+	}
+	defer rows.Close()
+
+	var results []model.SearchResult
+	for rows.Next() {
+		var result model.SearchResult
+		if err := rows.Scan(&result.ID, &result.ParentID, &result.Text, &result.Category, &result.Title, &result.Score); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// ftsQuery turns free text into an FTS5 query that matches any of its terms,
+// quoting each term so user input cannot inject FTS syntax.
+func ftsQuery(text string) string {
+	tokens := ftsTokenRegex.FindAllString(text, -1)
+	terms := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		terms = append(terms, `"`+strings.ToLower(t)+`"`)
+	}
+	return strings.Join(terms, " OR ")
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// RecordInjectionFlag records a question flagged as a prompt injection
+// attempt, along with why it was flagged and what was done about it.
+func (l *LibSQL) RecordInjectionFlag(ctx context.Context, reason, action, question string) error {
+	_, err := l.db.ExecContext(ctx,
+		"INSERT INTO injection_flags (reason, action, question) VALUES (?, ?, ?)",
+		reason, action, question,
+	)
+	return errors.Wrap(err, "failed to record injection flag")
+}
+
+// CountInjectionFlags returns the number of flagged questions per reason.
+func (l *LibSQL) CountInjectionFlags(ctx context.Context) (map[string]int, error) {
+	rows, err := l.db.QueryContext(ctx, "SELECT reason, COUNT(*) FROM injection_flags GROUP BY reason")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query injection flags")
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var reason string
+		var count int
+		if err := rows.Scan(&reason, &count); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		counts[reason] = count
+	}
+	return counts, rows.Err()
+}
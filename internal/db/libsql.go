@@ -3,12 +3,13 @@ package db
 import (
 	"context"
 	"database/sql"
-	"fmt"
 	"math"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 
+	"github.com/jcserv/portfolio-api/internal/model"
 	"github.com/jcserv/portfolio-api/internal/utils"
 	"github.com/pkg/errors"
 	_ "modernc.org/sqlite"
@@ -39,100 +40,106 @@ func NewLibSQL(ctx context.Context, dbPath string) (*LibSQL, error) {
 
 	l := &LibSQL{db: db}
 
-	if err := l.CreateEmbeddingsTable(ctx, db); err != nil {
+	if err := l.migrate(ctx); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return l, nil
 }
 
-func (l *LibSQL) CreateEmbeddingsTable(ctx context.Context, db *sql.DB) error {
-	_, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS embeddings (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			text TEXT NOT NULL,
-			embedding_blob BLOB NOT NULL,
-			content_hash CHAR(64) NOT NULL,
-			category TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	return err
-}
-
 func (l *LibSQL) Close() error {
 	return l.db.Close()
 }
 
-func (l *LibSQL) DoesEmbeddingExist(ctx context.Context, text string) (bool, error) {
-	hash := utils.HashContent(text)
-
-	query := `SELECT EXISTS(SELECT 1 FROM embeddings WHERE content_hash = $1)`
-
-	var exists bool
-	err := l.db.QueryRowContext(ctx, query, string(hash)).Scan(&exists)
+// ClearIndex deletes every document and embedding.
+func (l *LibSQL) ClearIndex(ctx context.Context) error {
+	tx, err := l.db.BeginTx(ctx, nil)
 	if err != nil {
-		return false, fmt.Errorf("checking content hash: %w", err)
+		return errors.Wrap(err, "failed to begin transaction")
 	}
-	return exists, nil
-}
+	defer tx.Rollback()
 
-func (l *LibSQL) StoreEmbedding(ctx context.Context, text string, embedding []float32, category string) error {
-	byteSlice := utils.Float32SliceToBytes(embedding)
-	hash := utils.HashContent(text)
-	_, err := l.db.ExecContext(ctx,
-		"INSERT INTO embeddings (text, embedding_blob, content_hash, category) VALUES (?, ?,?, ?)",
-		text, byteSlice, hash, category,
-	)
-	return errors.Wrap(err, "failed to store embedding")
+	if _, err := tx.ExecContext(ctx, "DELETE FROM embeddings"); err != nil {
+		return errors.Wrap(err, "failed to delete embeddings")
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM documents"); err != nil {
+		return errors.Wrap(err, "failed to delete documents")
+	}
+	return errors.Wrap(tx.Commit(), "failed to commit index deletion")
 }
 
-func (l *LibSQL) FindSimilar(ctx context.Context, queryEmbedding []float32, limit int) ([]string, error) {
+// FindSimilar ranks the chunks of documents matching filter by cosine
+// similarity to queryEmbedding. With mmr set, the chunks are selected by
+// maximal marginal relevance instead, and are returned in the order selected.
+func (l *LibSQL) FindSimilar(ctx context.Context, queryEmbedding []float32, limit int, filter model.SearchFilter, mmr *MMR) ([]model.SearchResult, error) {
+	where, args := filterClause(filter)
 	rows, err := l.db.QueryContext(ctx, `
-        SELECT text, category, embedding_blob 
-        FROM embeddings
-    `)
+        SELECT e.id, COALESCE(e.parent_id, 0), e.text, e.category, e.title, e.embedding_blob
+        FROM embeddings e
+        JOIN documents d ON d.id = e.parent_id
+        WHERE `+where, args...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to query embeddings")
 	}
 	defer rows.Close()
 
-	// Store results with their similarities for sorting
-	type Result struct {
-		Text       string
-		Similarity float64
-	}
-	var results []Result
+	var results []model.SearchResult
+	var embeddings [][]float32
 
 	// Calculate similarity for each embedding
 	for rows.Next() {
-		var text, category string
+		var result model.SearchResult
 		var embeddingBlob []byte
-		if err := rows.Scan(&text, &category, &embeddingBlob); err != nil {
+		if err := rows.Scan(&result.ID, &result.ParentID, &result.Text, &result.Category, &result.Title, &embeddingBlob); err != nil {
 			return nil, errors.Wrap(err, "failed to scan row")
 		}
 
 		embedding := utils.BytesToFloat32Slice(embeddingBlob)
-		similarity := calculateCosineSimilarity(queryEmbedding, embedding)
+		result.Score = calculateCosineSimilarity(queryEmbedding, embedding)
 
-		results = append(results, Result{
-			Text:       text,
-			Similarity: similarity,
-		})
+		results = append(results, result)
+		embeddings = append(embeddings, embedding)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read embeddings")
+	}
+
+	if mmr != nil {
+		return selectMMR(results, embeddings, limit, mmr.Lambda), nil
 	}
 
 	// Sort results by similarity (highest first)
 	sort.Slice(results, func(i, j int) bool {
-		return results[i].Similarity > results[j].Similarity
+		return results[i].Score > results[j].Score
 	})
 
 	// Take top N results
-	var texts []string
-	for i := 0; i < limit && i < len(results); i++ {
-		texts = append(texts, results[i].Text)
+	if len(results) > limit {
+		results = results[:limit]
 	}
 
-	return texts, nil
+	return results, nil
+}
+
+// filterClause returns an SQL condition on the embeddings e and their parent
+// documents d that matches filter, along with its arguments.
+func filterClause(filter model.SearchFilter) (string, []any) {
+	conditions := []string{"1 = 1"}
+	var args []any
+	if filter.Category != "" {
+		conditions = append(conditions, "e.category = ? COLLATE NOCASE")
+		args = append(args, filter.Category)
+	}
+	if filter.Workplace != "" {
+		conditions = append(conditions, "d.workplace = ? COLLATE NOCASE")
+		args = append(args, filter.Workplace)
+	}
+	for _, tech := range filter.Tech {
+		conditions = append(conditions, "EXISTS(SELECT 1 FROM json_each(d.tech) WHERE json_each.value = ? COLLATE NOCASE)")
+		args = append(args, tech)
+	}
+	return strings.Join(conditions, " AND "), args
 }
 
 func calculateCosineSimilarity(vec1, vec2 []float32) float64 {
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func (l *LibSQL) GetMetadata(ctx context.Context, key string) (string, bool, error) {
+	var value string
+	err := l.db.QueryRowContext(ctx, "SELECT value FROM metadata WHERE key = ?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, errors.Wrapf(err, "failed to get metadata %s", key)
+	}
+	return value, true, nil
+}
+
+func (l *LibSQL) SetMetadata(ctx context.Context, key, value string) error {
+	_, err := l.db.ExecContext(ctx, `
+		INSERT INTO metadata (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP
+	`, key, value)
+	return errors.Wrapf(err, "failed to set metadata %s", key)
+}
@@ -0,0 +1,300 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// migration is a numbered change to the schema. Migrations run in order, each
+// in its own transaction along with recording its version in the
+// schema_version table, so a failed migration leaves the database at the
+// previous version.
+//
+// Databases created before schema versions were recorded start at version 0
+// with any earlier form of the schema, so migrations must also apply cleanly
+// to tables and columns that already exist.
+type migration struct {
+	version     int
+	description string
+	up          func(ctx context.Context, tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{1, "create tables", createTables},
+	{2, "store chunk titles", storeChunkTitles},
+	{3, "link chunks to their documents", linkChunksToDocuments},
+	{4, "index chunks for full-text search", indexChunkText},
+	{5, "store structured cached answers", storeStructuredCachedAnswers},
+	{6, "tag documents with tech and workplace", tagDocuments},
+	{7, "key documents by their source", keyDocumentsBySource},
+}
+
+// migrate brings the schema up to the latest migration.
+func (l *LibSQL) migrate(ctx context.Context) error {
+	_, err := l.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			description TEXT NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return errors.Wrap(err, "failed to create schema_version table")
+	}
+
+	current, err := l.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than the latest known version %d", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := l.applyMigration(ctx, m); err != nil {
+			return errors.Wrapf(err, "failed to apply migration %d (%s)", m.version, m.description)
+		}
+	}
+	return nil
+}
+
+func (l *LibSQL) applyMigration(ctx context.Context, m migration) error {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(ctx, tx); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO schema_version (version, description) VALUES (?, ?)", m.version, m.description)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SchemaVersion returns the version of the latest migration applied, or 0 if
+// none have been.
+func (l *LibSQL) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := l.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get schema version")
+	}
+	return version, nil
+}
+
+// execAll runs statements in order.
+func execAll(ctx context.Context, tx *sql.Tx, statements ...string) error {
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addColumnIfMissing(ctx context.Context, tx *sql.Tx, table, column, definition string) (bool, error) {
+	var exists bool
+	err := tx.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE name = ?)", table, column,
+	).Scan(&exists)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to inspect table %s", table)
+	}
+	if exists {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to add column %s.%s", table, column)
+	}
+	return true, nil
+}
+
+func createTables(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE TABLE IF NOT EXISTS documents (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			category TEXT NOT NULL,
+			title TEXT NOT NULL,
+			text TEXT NOT NULL,
+			content_hash CHAR(64) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS embeddings (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			text TEXT NOT NULL,
+			embedding_blob BLOB NOT NULL,
+			content_hash CHAR(64) NOT NULL,
+			category TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS metadata (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS conversations (
+			id TEXT PRIMARY KEY,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS conversation_turns (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			conversation_id TEXT NOT NULL REFERENCES conversations(id),
+			role TEXT NOT NULL,
+			content TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_conversation_turns_conversation_id
+		ON conversation_turns (conversation_id)`,
+		`CREATE TABLE IF NOT EXISTS answer_cache (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			question TEXT NOT NULL,
+			question_embedding BLOB NOT NULL,
+			answer TEXT NOT NULL,
+			sources TEXT NOT NULL,
+			corpus_version TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS injection_flags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			reason TEXT NOT NULL,
+			action TEXT NOT NULL,
+			question TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		"CREATE INDEX IF NOT EXISTS idx_injection_flags_reason ON injection_flags (reason)",
+		`CREATE TABLE IF NOT EXISTS suggestions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			question TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS answers (
+			id TEXT PRIMARY KEY,
+			conversation_id TEXT NOT NULL,
+			question TEXT NOT NULL,
+			answer TEXT NOT NULL,
+			sources TEXT NOT NULL,
+			prompt_version TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS feedback (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			answer_id TEXT NOT NULL UNIQUE REFERENCES answers(id),
+			rating TEXT NOT NULL,
+			comment TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		"CREATE INDEX IF NOT EXISTS idx_feedback_rating ON feedback (rating)",
+	)
+}
+
+func storeChunkTitles(ctx context.Context, tx *sql.Tx) error {
+	if _, err := addColumnIfMissing(ctx, tx, "embeddings", "title", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	// Rows indexed before titles were stored start with "<title> - "
+	_, err := tx.ExecContext(ctx, `
+		UPDATE embeddings
+		SET title = substr(text, 1, instr(text, ' - ') - 1)
+		WHERE title = '' AND instr(text, ' - ') > 0
+	`)
+	return err
+}
+
+func linkChunksToDocuments(ctx context.Context, tx *sql.Tx) error {
+	if _, err := addColumnIfMissing(ctx, tx, "embeddings", "parent_id", "INTEGER REFERENCES documents(id)"); err != nil {
+		return err
+	}
+	// Retrieval only returns chunks of a stored document, so rows indexed
+	// before chunking, which embed whole documents and have no parent, can
+	// never be found again. The corpus is re-embedded as chunks when it is
+	// next indexed
+	_, err := tx.ExecContext(ctx, "DELETE FROM embeddings WHERE parent_id IS NULL OR parent_id NOT IN (SELECT id FROM documents)")
+	if err != nil {
+		return errors.Wrap(err, "failed to delete unchunked embeddings")
+	}
+	_, err = tx.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS idx_embeddings_parent_id ON embeddings (parent_id)")
+	return err
+}
+
+// indexChunkText creates an FTS5 index over embeddings.text, kept in sync with
+// the embeddings table by triggers.
+func indexChunkText(ctx context.Context, tx *sql.Tx) error {
+	err := execAll(ctx, tx,
+		`CREATE VIRTUAL TABLE IF NOT EXISTS embeddings_fts USING fts5(
+			text,
+			content='embeddings',
+			content_rowid='id',
+			tokenize='porter unicode61'
+		)`,
+		`CREATE TRIGGER IF NOT EXISTS embeddings_fts_insert AFTER INSERT ON embeddings BEGIN
+			INSERT INTO embeddings_fts(rowid, text) VALUES (new.id, new.text);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS embeddings_fts_delete AFTER DELETE ON embeddings BEGIN
+			INSERT INTO embeddings_fts(embeddings_fts, rowid, text) VALUES ('delete', old.id, old.text);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS embeddings_fts_update AFTER UPDATE OF text ON embeddings BEGIN
+			INSERT INTO embeddings_fts(embeddings_fts, rowid, text) VALUES ('delete', old.id, old.text);
+			INSERT INTO embeddings_fts(rowid, text) VALUES (new.id, new.text);
+		END`,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to create fts table")
+	}
+
+	// Index rows that were stored before the fts table existed
+	_, err = tx.ExecContext(ctx, "INSERT INTO embeddings_fts(embeddings_fts) VALUES ('rebuild')")
+	return errors.Wrap(err, "failed to rebuild fts table")
+}
+
+func storeStructuredCachedAnswers(ctx context.Context, tx *sql.Tx) error {
+	for _, column := range []struct{ name, definition string }{
+		{"follow_up_questions", "TEXT NOT NULL DEFAULT '[]'"},
+		{"entities", "TEXT NOT NULL DEFAULT '[]'"},
+		{"language", "TEXT NOT NULL DEFAULT 'en'"},
+	} {
+		if _, err := addColumnIfMissing(ctx, tx, "answer_cache", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+	// Answers cached before they were structured have no follow-up questions
+	// or entities, and may be in any language. The cache refills as
+	// questions are answered
+	_, err := tx.ExecContext(ctx, "DELETE FROM answer_cache")
+	return errors.Wrap(err, "failed to clear unstructured cached answers")
+}
+
+// tagDocuments adds the tags retrieval filters on. Documents indexed before
+// them have no tags, and no source key either, so they are kept searchable
+// until the next time the corpus is indexed replaces them.
+func tagDocuments(ctx context.Context, tx *sql.Tx) error {
+	if _, err := addColumnIfMissing(ctx, tx, "documents", "tech", "TEXT NOT NULL DEFAULT '[]'"); err != nil {
+		return err
+	}
+	_, err := addColumnIfMissing(ctx, tx, "documents", "workplace", "TEXT NOT NULL DEFAULT ''")
+	return err
+}
+
+// keyDocumentsBySource adds the key documents are matched to the corpus by.
+// Documents indexed before source keys were stored have an empty key, and are
+// replaced the next time the corpus is indexed.
+func keyDocumentsBySource(ctx context.Context, tx *sql.Tx) error {
+	if _, err := addColumnIfMissing(ctx, tx, "documents", "source_key", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS idx_documents_source_key ON documents (source_key) WHERE source_key != ''")
+	return err
+}
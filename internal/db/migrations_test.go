@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	latest := migrations[len(migrations)-1].version
+
+	tests := []struct {
+		name string
+		// setup runs against the database file before it is opened
+		setup   func(t *testing.T, db *sql.DB)
+		wantErr bool
+		// wantDocuments is how many documents are kept
+		wantDocuments int
+	}{
+		{"new database", nil, false, 0},
+		{"database without schema versions", createLegacySchema, false, 1},
+		{"newer schema", func(t *testing.T, db *sql.DB) {
+			mustExec(t, db,
+				"CREATE TABLE schema_version (version INTEGER PRIMARY KEY, description TEXT NOT NULL, applied_at TIMESTAMP)",
+				"INSERT INTO schema_version (version, description) VALUES (1000, 'from the future')",
+			)
+		}, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			path := filepath.Join(t.TempDir(), "test.db")
+			if tt.setup != nil {
+				db, err := sql.Open("sqlite", path)
+				if err != nil {
+					t.Fatalf("sql.Open() error = %v", err)
+				}
+				tt.setup(t, db)
+				db.Close()
+			}
+
+			l, err := NewLibSQL(ctx, path)
+			if tt.wantErr {
+				if err == nil {
+					l.Close()
+					t.Fatal("NewLibSQL() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewLibSQL() error = %v", err)
+			}
+			defer l.Close()
+
+			version, err := l.SchemaVersion(ctx)
+			if err != nil {
+				t.Fatalf("SchemaVersion() error = %v", err)
+			}
+			if version != latest {
+				t.Errorf("SchemaVersion() = %d, want %d", version, latest)
+			}
+
+			docs, err := l.ListDocuments(ctx)
+			if err != nil {
+				t.Fatalf("ListDocuments() error = %v", err)
+			}
+			if len(docs) != tt.wantDocuments {
+				t.Errorf("ListDocuments() returned %d documents, want %d", len(docs), tt.wantDocuments)
+			}
+
+			// Migrations already applied are not run again
+			l.Close()
+			l, err = NewLibSQL(ctx, path)
+			if err != nil {
+				t.Fatalf("reopening: NewLibSQL() error = %v", err)
+			}
+			var applied int
+			if err := l.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_version").Scan(&applied); err != nil {
+				t.Fatalf("counting migrations: %v", err)
+			}
+			if applied != len(migrations) {
+				t.Errorf("%d migrations recorded, want %d", applied, len(migrations))
+			}
+		})
+	}
+}
+
+// createLegacySchema creates the schema as it was before schema versions were
+// recorded and documents were tagged, with one chunked document.
+func createLegacySchema(t *testing.T, db *sql.DB) {
+	mustExec(t, db,
+		`CREATE TABLE documents (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			category TEXT NOT NULL,
+			title TEXT NOT NULL,
+			text TEXT NOT NULL,
+			content_hash CHAR(64) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE embeddings (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			text TEXT NOT NULL,
+			embedding_blob BLOB NOT NULL,
+			content_hash CHAR(64) NOT NULL,
+			category TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			title TEXT NOT NULL DEFAULT '',
+			parent_id INTEGER REFERENCES documents(id)
+		)`,
+		"INSERT INTO documents (category, title, text, content_hash) VALUES ('project', 'ResumeWords', 'ResumeWords - Scores resumes', 'hash')",
+		"INSERT INTO embeddings (text, embedding_blob, content_hash, category, title, parent_id) VALUES ('ResumeWords - Scores resumes', x'00', 'hash', 'project', 'ResumeWords', 1)",
+	)
+}
+
+func mustExec(t *testing.T, db *sql.DB, statements ...string) {
+	t.Helper()
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("executing %q: %v", stmt, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"math"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+)
+
+// sameCategoryRedundancy is how far chunks of the same category are moved
+// towards being redundant, so results spread across experiences and projects.
+const sameCategoryRedundancy = 0.25
+
+// MMR makes FindSimilar select results by maximal marginal relevance: each
+// result is the one that best balances similarity to the query against
+// redundancy with the results already selected. Lambda weighs relevance
+// against diversity, from 0 (only diversity) to 1 (only relevance).
+type MMR struct {
+	Lambda float64
+}
+
+// selectMMR returns limit of the results in the order MMR selects them.
+// results are scored by similarity to the query, and embeddings[i] is the
+// embedding of results[i].
+func selectMMR(results []model.SearchResult, embeddings [][]float32, limit int, lambda float64) []model.SearchResult {
+	if limit > len(results) {
+		limit = len(results)
+	}
+
+	selected := make([]model.SearchResult, 0, limit)
+	used := make([]bool, len(results))
+	// redundancy[i] is the highest redundancy of results[i] with any
+	// selected result
+	redundancy := make([]float64, len(results))
+	for len(selected) < limit {
+		best, bestScore := -1, math.Inf(-1)
+		for i, r := range results {
+			if used[i] {
+				continue
+			}
+			if score := lambda*r.Score - (1-lambda)*redundancy[i]; score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		used[best] = true
+		selected = append(selected, results[best])
+		for i := range results {
+			if used[i] {
+				continue
+			}
+			r := chunkRedundancy(results[i], embeddings[i], results[best], embeddings[best])
+			if r > redundancy[i] {
+				redundancy[i] = r
+			}
+		}
+	}
+	return selected
+}
+
+// chunkRedundancy scores how much two chunks repeat each other. Chunks of the
+// same document are fully redundant, and others are as redundant as their
+// embeddings are similar, more so if they share a category.
+func chunkRedundancy(a model.SearchResult, aEmbedding []float32, b model.SearchResult, bEmbedding []float32) float64 {
+	if a.ParentID != 0 && a.ParentID == b.ParentID {
+		return 1
+	}
+	similarity := calculateCosineSimilarity(aEmbedding, bEmbedding)
+	if a.Category == b.Category {
+		similarity += (1 - similarity) * sameCategoryRedundancy
+	}
+	return similarity
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+)
+
+func TestSelectMMR(t *testing.T) {
+	// a, b and c are chunks of different documents. a and b are experiences
+	// with orthogonal embeddings, and c is a project with the same embedding
+	// as b
+	a := model.SearchResult{ID: 1, ParentID: 10, Category: model.CategoryExperience, Score: 0.9}
+	b := model.SearchResult{ID: 2, ParentID: 20, Category: model.CategoryExperience, Score: 0.8}
+	c := model.SearchResult{ID: 3, ParentID: 30, Category: model.CategoryProject, Score: 0.75}
+	sameParent := model.SearchResult{ID: 4, ParentID: 10, Category: model.CategoryExperience, Score: 0.85}
+	duplicate := model.SearchResult{ID: 5, ParentID: 50, Category: model.CategoryProject, Score: 0.85}
+
+	x, y := []float32{1, 0}, []float32{0, 1}
+
+	tests := []struct {
+		name       string
+		results    []model.SearchResult
+		embeddings [][]float32
+		limit      int
+		lambda     float64
+		want       []int64
+	}{
+		{"relevance only", []model.SearchResult{a, b, c}, [][]float32{x, y, y}, 3, 1, []int64{1, 2, 3}},
+		{"other categories first", []model.SearchResult{a, b, c}, [][]float32{x, y, y}, 3, 0.7, []int64{1, 3, 2}},
+		{"chunks of a selected document last", []model.SearchResult{a, sameParent, c}, [][]float32{x, y, y}, 3, 0.7, []int64{1, 3, 4}},
+		{"similar embeddings last", []model.SearchResult{a, duplicate, b}, [][]float32{x, x, y}, 3, 0.7, []int64{1, 2, 5}},
+		{"limit", []model.SearchResult{a, b, c}, [][]float32{x, y, y}, 2, 0.7, []int64{1, 3}},
+		{"limit over results", []model.SearchResult{a, b}, [][]float32{x, y}, 5, 0.7, []int64{1, 2}},
+		{"no results", nil, nil, 5, 0.7, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := selectMMR(tt.results, tt.embeddings, tt.limit, tt.lambda)
+			ids := make([]int64, 0, len(got))
+			for _, r := range got {
+				ids = append(ids, r.ID)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("selectMMR() = %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Fatalf("selectMMR() = %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+const suggestionsContentHashKey = "suggestions_content_hash"
+
+// GetSuggestionsContentHash returns the content hash of the corpus the stored
+// suggestions were generated from.
+func (l *LibSQL) GetSuggestionsContentHash(ctx context.Context) (string, bool, error) {
+	return l.GetMetadata(ctx, suggestionsContentHashKey)
+}
+
+// ReplaceSuggestions replaces the generated suggestions, recording the content
+// hash of the corpus they were generated from.
+func (l *LibSQL) ReplaceSuggestions(ctx context.Context, contentHash string, questions []string) error {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM suggestions"); err != nil {
+		return errors.Wrap(err, "failed to delete suggestions")
+	}
+	for _, q := range questions {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO suggestions (question) VALUES (?)", q); err != nil {
+			return errors.Wrap(err, "failed to store suggestion")
+		}
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO metadata (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP
+	`, suggestionsContentHashKey, contentHash)
+	if err != nil {
+		return errors.Wrapf(err, "failed to set metadata %s", suggestionsContentHashKey)
+	}
+	return errors.Wrap(tx.Commit(), "failed to commit suggestions")
+}
+
+// GetSuggestions returns the generated suggestions in the order they were
+// stored.
+func (l *LibSQL) GetSuggestions(ctx context.Context) ([]string, error) {
+	rows, err := l.db.QueryContext(ctx, "SELECT question FROM suggestions ORDER BY id")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query suggestions")
+	}
+	defer rows.Close()
+
+	var questions []string
+	for rows.Next() {
+		var q string
+		if err := rows.Scan(&q); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
@@ -0,0 +1,208 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jcserv/portfolio-api/internal/db"
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/jcserv/portfolio-api/internal/rag"
+)
+
+// GoldenQuestion is a question along with the titles of the documents that
+// should be retrieved for it.
+type GoldenQuestion struct {
+	Question string   `json:"question"`
+	Expected []string `json:"expected"`
+}
+
+// Metrics score a ranking of documents against the expected ones, over the
+// top k documents.
+type Metrics struct {
+	RecallAtK float64 `json:"recall_at_k"`
+	MRR       float64 `json:"mrr"`
+	NDCG      float64 `json:"ndcg"`
+}
+
+// Result is the evaluation of a single golden question.
+type Result struct {
+	Question  GoldenQuestion
+	Retrieved []string
+	Metrics   Metrics
+}
+
+// ReadGolden reads the golden questions, each of which must have a question
+// and at least one expected document.
+func ReadGolden(path string) ([]GoldenQuestion, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var golden []GoldenQuestion
+	if err := json.NewDecoder(file).Decode(&golden); err != nil {
+		return nil, err
+	}
+	for i, q := range golden {
+		if q.Question == "" || len(q.Expected) == 0 {
+			return nil, fmt.Errorf("golden question %d must have a question and expected documents", i+1)
+		}
+	}
+	return golden, nil
+}
+
+// Run retrieves documents for each golden question with FindSimilar and
+// scores the top k. Documents are ranked by their best chunk.
+func Run(ctx context.Context, l *db.LibSQL, embedder rag.EmbeddingProvider, golden []GoldenQuestion, k int) ([]Result, error) {
+	results := make([]Result, 0, len(golden))
+	for _, q := range golden {
+		embedding, err := embedder.GetEmbedding(ctx, q.Question)
+		if err != nil {
+			return nil, err
+		}
+		// Every chunk is ranked, so documents are not cut off by chunks of
+		// the documents above them
+		chunks, err := l.FindSimilar(ctx, embedding, math.MaxInt32, model.SearchFilter{}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var retrieved []string
+		seen := make(map[string]struct{})
+		for _, chunk := range chunks {
+			if _, ok := seen[chunk.Title]; ok {
+				continue
+			}
+			seen[chunk.Title] = struct{}{}
+			retrieved = append(retrieved, chunk.Title)
+			if len(retrieved) == k {
+				break
+			}
+		}
+
+		results = append(results, Result{
+			Question:  q,
+			Retrieved: retrieved,
+			Metrics:   Score(retrieved, q.Expected, k),
+		})
+	}
+	return results, nil
+}
+
+// Score computes recall@k, reciprocal rank and nDCG@k of the ranked titles,
+// treating every expected document as equally relevant.
+func Score(retrieved, expected []string, k int) Metrics {
+	relevant := make(map[string]struct{}, len(expected))
+	for _, title := range expected {
+		relevant[strings.ToLower(title)] = struct{}{}
+	}
+	if len(retrieved) > k {
+		retrieved = retrieved[:k]
+	}
+
+	var m Metrics
+	var found int
+	var dcg float64
+	for i, title := range retrieved {
+		if _, ok := relevant[strings.ToLower(title)]; !ok {
+			continue
+		}
+		found++
+		if m.MRR == 0 {
+			m.MRR = 1 / float64(i+1)
+		}
+		dcg += 1 / math.Log2(float64(i+2))
+	}
+
+	var idcg float64
+	for i := 0; i < len(relevant) && i < k; i++ {
+		idcg += 1 / math.Log2(float64(i+2))
+	}
+	m.RecallAtK = float64(found) / float64(len(relevant))
+	if idcg > 0 {
+		m.NDCG = dcg / idcg
+	}
+	return m
+}
+
+// Mean averages the metrics of the results.
+func Mean(results []Result) Metrics {
+	var m Metrics
+	if len(results) == 0 {
+		return m
+	}
+	for _, r := range results {
+		m.RecallAtK += r.Metrics.RecallAtK
+		m.MRR += r.Metrics.MRR
+		m.NDCG += r.Metrics.NDCG
+	}
+	n := float64(len(results))
+	return Metrics{RecallAtK: m.RecallAtK / n, MRR: m.MRR / n, NDCG: m.NDCG / n}
+}
+
+// BaselineEntry is a saved evaluation to compare later ones against.
+type BaselineEntry struct {
+	K int `json:"k"`
+	Metrics
+}
+
+// Baseline holds an entry per embedding model, since scores from different
+// models are not comparable.
+type Baseline map[string]BaselineEntry
+
+// ReadBaseline returns the saved baseline, or an empty one if there is none.
+func ReadBaseline(path string) (Baseline, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Baseline{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	baseline := Baseline{}
+	if err := json.NewDecoder(file).Decode(&baseline); err != nil {
+		return nil, err
+	}
+	return baseline, nil
+}
+
+// WriteBaseline saves the baseline as indented JSON, replacing the previous
+// one.
+func WriteBaseline(path string, baseline Baseline) error {
+	content, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0o644)
+}
+
+// Regressions lists the metrics that fell more than tolerance below the
+// baseline.
+func (m Metrics) Regressions(baseline Metrics, tolerance float64) []string {
+	metrics := []struct {
+		name            string
+		value, baseline float64
+	}{
+		{"recall@k", m.RecallAtK, baseline.RecallAtK},
+		{"mrr", m.MRR, baseline.MRR},
+		{"ndcg", m.NDCG, baseline.NDCG},
+	}
+
+	var regressions []string
+	for _, metric := range metrics {
+		if metric.value < metric.baseline-tolerance {
+			regressions = append(regressions, fmt.Sprintf("%s fell from %.4f to %.4f", metric.name, metric.baseline, metric.value))
+		}
+	}
+	sort.Strings(regressions)
+	return regressions
+}
@@ -0,0 +1,97 @@
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+// closeTo reports whether the metrics are equal to 4 decimal places, as they
+// are printed.
+func closeTo(got, want Metrics) bool {
+	const epsilon = 1e-4
+	return math.Abs(got.RecallAtK-want.RecallAtK) < epsilon &&
+		math.Abs(got.MRR-want.MRR) < epsilon &&
+		math.Abs(got.NDCG-want.NDCG) < epsilon
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		retrieved []string
+		expected  []string
+		k         int
+		want      Metrics
+	}{
+		{"expected first", []string{"a", "b", "x"}, []string{"a", "b"}, 3, Metrics{RecallAtK: 1, MRR: 1, NDCG: 1}},
+		{"expected second", []string{"x", "a"}, []string{"a"}, 2, Metrics{RecallAtK: 1, MRR: 0.5, NDCG: 0.6309}},
+		{"gap between expected", []string{"a", "x", "b"}, []string{"a", "b"}, 3, Metrics{RecallAtK: 1, MRR: 1, NDCG: 0.9197}},
+		{"no expected documents retrieved", []string{"x", "y"}, []string{"a"}, 2, Metrics{}},
+		{"expected below k", []string{"x", "a"}, []string{"a"}, 1, Metrics{}},
+		{"more expected than k", []string{"a"}, []string{"a", "b"}, 1, Metrics{RecallAtK: 0.5, MRR: 1, NDCG: 1}},
+		{"titles are case insensitive", []string{"ResumeWords"}, []string{"resumewords"}, 1, Metrics{RecallAtK: 1, MRR: 1, NDCG: 1}},
+		{"nothing retrieved", nil, []string{"a"}, 3, Metrics{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Score(tt.retrieved, tt.expected, tt.k); !closeTo(got, tt.want) {
+				t.Errorf("Score() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMean(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []Result
+		want    Metrics
+	}{
+		{"no results", nil, Metrics{}},
+		{"one result", []Result{{Metrics: Metrics{RecallAtK: 1, MRR: 0.5, NDCG: 0.6309}}}, Metrics{RecallAtK: 1, MRR: 0.5, NDCG: 0.6309}},
+		{"averages each metric", []Result{
+			{Metrics: Metrics{RecallAtK: 1, MRR: 1, NDCG: 1}},
+			{Metrics: Metrics{RecallAtK: 0, MRR: 0.5, NDCG: 0}},
+		}, Metrics{RecallAtK: 0.5, MRR: 0.75, NDCG: 0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Mean(tt.results); !closeTo(got, tt.want) {
+				t.Errorf("Mean() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegressions(t *testing.T) {
+	baseline := Metrics{RecallAtK: 0.9, MRR: 0.8, NDCG: 0.7}
+
+	tests := []struct {
+		name      string
+		metrics   Metrics
+		tolerance float64
+		want      []string
+	}{
+		{"same as baseline", baseline, 0.01, nil},
+		{"improved", Metrics{RecallAtK: 1, MRR: 0.9, NDCG: 0.8}, 0.01, nil},
+		{"within tolerance", Metrics{RecallAtK: 0.895, MRR: 0.8, NDCG: 0.7}, 0.01, nil},
+		{"one metric fell", Metrics{RecallAtK: 0.9, MRR: 0.7, NDCG: 0.7}, 0.01, []string{"mrr fell from 0.8000 to 0.7000"}},
+		{"sorted by metric", Metrics{RecallAtK: 0.5, MRR: 0.8, NDCG: 0.5}, 0.01, []string{
+			"ndcg fell from 0.7000 to 0.5000",
+			"recall@k fell from 0.9000 to 0.5000",
+		}},
+		{"no tolerance", Metrics{RecallAtK: 0.8999, MRR: 0.8, NDCG: 0.7}, 0, []string{"recall@k fell from 0.9000 to 0.8999"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.metrics.Regressions(baseline, tt.tolerance)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Regressions() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Regressions() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package model
+
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Turn struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
@@ -0,0 +1,23 @@
+package model
+
+// Document is an indexed experience or project. Documents are embedded as
+// one or more chunks, and retrieval hands whole documents to the LLM.
+type Document struct {
+	ID       int64  `json:"id"`
+	Category string `json:"category"`
+	Title    string `json:"title"`
+	Text     string `json:"text"`
+	// Tech and Workplace are stored for filtering retrieval. Only
+	// experiences have a workplace
+	Tech      []string `json:"tech,omitempty"`
+	Workplace string   `json:"workplace,omitempty"`
+	// SourceKey identifies the entry of the corpus the document was indexed
+	// from, e.g. "projects.json:mjurl", so edits replace it
+	SourceKey string `json:"source_key,omitempty"`
+}
+
+// Chunk is a piece of a document along with its embedding.
+type Chunk struct {
+	Text      string
+	Embedding []float32
+}
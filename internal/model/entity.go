@@ -0,0 +1,12 @@
+package model
+
+const (
+	EntityEmployer = "employer"
+	EntityProject  = "project"
+)
+
+// Entity is an employer or project mentioned in an answer.
+type Entity struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
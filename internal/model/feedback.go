@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// Answer is a response given to a question, kept so feedback can refer to it.
+type Answer struct {
+	ID             string
+	ConversationID string
+	Question       string
+	Answer         string
+	Sources        []SearchResult
+	PromptVersion  string
+	CreatedAt      time.Time
+}
+
+// Feedback is a visitor's rating of an answer.
+type Feedback struct {
+	ID        int64
+	Rating    string
+	Comment   string
+	CreatedAt time.Time
+	Answer    Answer
+}
@@ -9,6 +9,10 @@ type Experience struct {
 	URL         string   `json:"url"`
 }
 
+func (e *Experience) Title() string {
+	return e.Workplace
+}
+
 func (e *Experience) String() string {
 	workplace := e.Workplace
 	position := e.Position
@@ -29,6 +33,10 @@ type Project struct {
 	Links       []Link   `json:"links"`
 }
 
+func (p *Project) Title() string {
+	return p.Name
+}
+
 func (p *Project) String() string {
 	name := p.Name
 	description := p.Description
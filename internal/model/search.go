@@ -0,0 +1,61 @@
+package model
+
+import "strings"
+
+const (
+	CategoryExperience = "experience"
+	CategoryProject    = "project"
+)
+
+// SearchResult is an indexed document or chunk returned by retrieval, along
+// with how well it matched the query. ParentID is set on chunks.
+type SearchResult struct {
+	ID       int64   `json:"id"`
+	ParentID int64   `json:"parent_id,omitempty"`
+	Category string  `json:"category"`
+	Title    string  `json:"title"`
+	Text     string  `json:"text"`
+	Score    float64 `json:"score"`
+	// RerankScore is set when a reranker has scored the result
+	RerankScore *float64 `json:"rerank_score,omitempty"`
+}
+
+// SearchFilter restricts retrieval to documents matching every field that is
+// set. Documents must be tagged with all of Tech, and Category and Workplace
+// match exactly, ignoring case.
+type SearchFilter struct {
+	Category  string
+	Tech      []string
+	Workplace string
+}
+
+func (f SearchFilter) IsZero() bool {
+	return f.Category == "" && len(f.Tech) == 0 && f.Workplace == ""
+}
+
+func (f SearchFilter) String() string {
+	var parts []string
+	if f.Category != "" {
+		parts = append(parts, "category="+f.Category)
+	}
+	if len(f.Tech) > 0 {
+		parts = append(parts, "tech="+strings.Join(f.Tech, ","))
+	}
+	if f.Workplace != "" {
+		parts = append(parts, "workplace="+f.Workplace)
+	}
+	return strings.Join(parts, " ")
+}
+
+// CachedAnswer is a previously generated answer, along with how similar its
+// question is to the one being asked.
+type CachedAnswer struct {
+	ID                int64
+	Question          string
+	Answer            string
+	FollowUpQuestions []string
+	Entities          []Entity
+	Sources           []SearchResult
+	Language          string
+	Similarity        float64
+}
@@ -0,0 +1,12 @@
+package model
+
+const (
+	SuggestionCurated   = "curated"
+	SuggestionGenerated = "generated"
+)
+
+// Suggestion is a starter question shown to visitors before they ask one.
+type Suggestion struct {
+	Question string `json:"question"`
+	Source   string `json:"source"`
+}
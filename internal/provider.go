@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/jcserv/portfolio-api/internal/api/ollama"
+	"github.com/jcserv/portfolio-api/internal/api/openai"
+	"github.com/jcserv/portfolio-api/internal/rag"
+)
+
+// NewProviders returns the embedding and chat backends selected by
+// LLM_PROVIDER.
+func NewProviders(cfg *Configuration) (rag.EmbeddingProvider, rag.ChatProvider, error) {
+	switch cfg.LLMProvider {
+	case rag.ProviderOpenAI:
+		client := openai.NewClient(cfg.OpenAIKey)
+		if cfg.OpenAIBaseURL != "" {
+			client = openai.NewClientWithBaseURL(cfg.OpenAIKey, cfg.OpenAIBaseURL)
+		}
+		p := rag.NewOpenAIProvider(client, cfg.ChatModel, cfg.EmbeddingModel)
+		return p, p, nil
+	case rag.ProviderOllama:
+		p := rag.NewOllamaProvider(ollama.NewClient(cfg.OllamaBaseURL), cfg.ChatModel, cfg.EmbeddingModel)
+		return p, p, nil
+	case rag.ProviderLocal:
+		p := rag.NewLocalProvider()
+		return p, p, nil
+	}
+	return nil, nil, fmt.Errorf("unknown llm provider: %s", cfg.LLMProvider)
+}
@@ -0,0 +1,71 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/jcserv/portfolio-api/internal/utils/log"
+)
+
+// UpdateCorpusVersion records the version of the indexed corpus. Cached
+// answers are invalidated when it changes.
+func (s *Service) UpdateCorpusVersion(ctx context.Context) error {
+	version, err := s.db.ComputeCorpusVersion(ctx, s.embedder.EmbeddingModel(), s.cfg.Prompt.Version())
+	if err != nil {
+		return err
+	}
+
+	changed, err := s.db.SetCorpusVersion(ctx, version)
+	if err != nil {
+		return err
+	}
+	if changed {
+		log.Info(ctx, fmt.Sprintf("corpus version changed to %s, cleared answer cache", version))
+	}
+	return nil
+}
+
+// cachedResponse returns the cached answer to a similar question, if any.
+func (s *Service) cachedResponse(ctx context.Context, p *pendingAnswer) *Response {
+	cached, err := s.db.FindCachedAnswer(ctx, p.questionEmbedding, s.cfg.AnswerCacheThreshold, p.gen.language)
+	if err != nil {
+		log.Error(ctx, fmt.Sprintf("unable to look up answer cache: %v", err))
+		return nil
+	}
+	if cached == nil {
+		return nil
+	}
+
+	log.Info(ctx, fmt.Sprintf("answering question: %s from cache of question: %s (similarity %.3f)", p.req.Question, cached.Question, cached.Similarity))
+	s.recordTurns(ctx, p.conv, p.req.Question, cached.Answer)
+	resp := &Response{
+		ConversationID:    p.conv.ID,
+		Answer:            cached.Answer,
+		FollowUpQuestions: cached.FollowUpQuestions,
+		Entities:          cached.Entities,
+		Sources:           cached.Sources,
+		Cached:            true,
+		PromptVersion:     s.cfg.Prompt.Version(),
+		Language:          cached.Language,
+	}
+	s.recordAnswer(ctx, p.req.Question, resp)
+	return resp
+}
+
+func (s *Service) cacheAnswer(ctx context.Context, p *pendingAnswer, answer generatedAnswer) {
+	if p.questionEmbedding == nil || answer.Text == "" {
+		return
+	}
+	err := s.db.StoreCachedAnswer(ctx, p.questionEmbedding, model.CachedAnswer{
+		Question:          p.req.Question,
+		Answer:            answer.Text,
+		FollowUpQuestions: answer.FollowUpQuestions,
+		Entities:          answer.Entities,
+		Sources:           p.sources,
+		Language:          p.gen.language,
+	})
+	if err != nil {
+		log.Error(ctx, fmt.Sprintf("unable to cache answer: %v", err))
+	}
+}
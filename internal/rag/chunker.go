@@ -0,0 +1,31 @@
+package rag
+
+import (
+	"strings"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+)
+
+// chunkExperience splits an experience into one chunk per description bullet,
+// each prefixed with the workplace and position so it stands on its own.
+func chunkExperience(exp model.Experience) []string {
+	header := exp.Workplace + " - " + exp.Position
+	if len(exp.Description) == 0 {
+		return []string{header}
+	}
+
+	chunks := make([]string, 0, len(exp.Description))
+	for _, desc := range exp.Description {
+		chunks = append(chunks, header+"\n- "+desc)
+	}
+	return chunks
+}
+
+// chunkProject splits a project into its description and its tech stack.
+func chunkProject(proj model.Project) []string {
+	chunks := []string{proj.Name + " - " + proj.Description}
+	if len(proj.Tech) > 0 {
+		chunks = append(chunks, proj.Name+" - built with "+strings.Join(proj.Tech, ", "))
+	}
+	return chunks
+}
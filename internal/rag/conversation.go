@@ -0,0 +1,122 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/jcserv/portfolio-api/internal/utils/log"
+	"github.com/sashabaranov/go-openai"
+)
+
+const rewritePrompt = `Given the conversation so far and a follow-up question, rewrite the follow-up
+question as a standalone question that can be understood without the conversation.
+Only return the rewritten question. If the question is already standalone, return it unchanged.`
+
+type conversation struct {
+	ID      string
+	History []model.Turn
+}
+
+// loadConversation returns the conversation with the given id along with its
+// recent history. A new conversation is started if id is empty, unknown or
+// expired.
+func (s *Service) loadConversation(ctx context.Context, id string) (*conversation, error) {
+	if id != "" {
+		active, err := s.db.IsConversationActive(ctx, id, s.cfg.ConversationTTL)
+		if err != nil {
+			return nil, err
+		}
+		if active {
+			history, err := s.db.GetConversationTurns(ctx, id, s.cfg.ConversationHistoryLimit)
+			if err != nil {
+				return nil, err
+			}
+			return &conversation{ID: id, History: history}, nil
+		}
+	}
+
+	id, err := s.db.CreateConversation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conversation{ID: id}, nil
+}
+
+func (s *Service) recordTurns(ctx context.Context, conv *conversation, question, answer string) {
+	err := s.db.AppendConversationTurns(ctx, conv.ID,
+		model.Turn{Role: model.RoleUser, Content: question},
+		model.Turn{Role: model.RoleAssistant, Content: answer},
+	)
+	if err != nil {
+		log.Error(ctx, fmt.Sprintf("unable to record conversation turns: %v", err))
+	}
+}
+
+// rewriteQuestion turns a follow-up question into a standalone one using the
+// conversation history, so retrieval is not limited to the latest message.
+// The original question is returned if there is no history or rewriting fails.
+func (s *Service) rewriteQuestion(ctx context.Context, question string, history []model.Turn) string {
+	if len(history) == 0 {
+		return question
+	}
+
+	var transcript strings.Builder
+	for _, turn := range history {
+		transcript.WriteString(turn.Role + ": " + turn.Content + "\n")
+	}
+
+	completion, err := s.chat.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: rewritePrompt,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: "Conversation:\n" + transcript.String() + "\nFollow-up question: " + question,
+			},
+		},
+	})
+	if err != nil {
+		log.Error(ctx, fmt.Sprintf("unable to rewrite question: %v", err))
+		return question
+	}
+	message, err := firstMessage(completion)
+	if err != nil {
+		log.Error(ctx, fmt.Sprintf("unable to rewrite question: %v", err))
+		return question
+	}
+
+	rewritten := strings.TrimSpace(message.Content)
+	if rewritten == "" {
+		return question
+	}
+	log.Info(ctx, fmt.Sprintf("rewrote question: %s as: %s", question, rewritten))
+	return rewritten
+}
+
+// ExpireConversations deletes conversations that have outlived the configured
+// ttl.
+func (s *Service) ExpireConversations(ctx context.Context) error {
+	n, err := s.db.DeleteExpiredConversations(ctx, s.cfg.ConversationTTL)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Info(ctx, fmt.Sprintf("expired %d conversations", n))
+	}
+	return nil
+}
+
+func historyMessages(history []model.Turn) []openai.ChatCompletionMessage {
+	messages := make([]openai.ChatCompletionMessage, 0, len(history))
+	for _, turn := range history {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    turn.Role,
+			Content: turn.Content,
+		})
+	}
+	return messages
+}
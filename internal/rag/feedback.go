@@ -0,0 +1,64 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/jcserv/portfolio-api/internal/utils/log"
+)
+
+// maxFeedbackCommentLength caps feedback comments, in characters.
+const maxFeedbackCommentLength = 2000
+
+// ErrAnswerNotFound is returned when feedback is given on an unknown answer.
+var ErrAnswerNotFound = errors.New("answer not found")
+
+// recordAnswer stores a response so feedback can refer to it, and assigns
+// the response its answer ID. If the answer can't be stored, the response
+// has no ID.
+func (s *Service) recordAnswer(ctx context.Context, question string, resp *Response) {
+	id, err := s.db.StoreAnswer(ctx, model.Answer{
+		ConversationID: resp.ConversationID,
+		Question:       question,
+		Answer:         resp.Answer,
+		Sources:        resp.Sources,
+		PromptVersion:  resp.PromptVersion,
+	})
+	if err != nil {
+		log.Error(ctx, fmt.Sprintf("unable to record answer: %v", err))
+		return
+	}
+	resp.AnswerID = id
+}
+
+// SubmitFeedback records a visitor's rating of an answer, replacing any
+// earlier rating of it.
+func (s *Service) SubmitFeedback(ctx context.Context, answerID, rating, comment string) error {
+	if rating != model.RatingUp && rating != model.RatingDown {
+		return &InvalidRequestError{Reason: fmt.Sprintf("rating must be %s or %s", model.RatingUp, model.RatingDown)}
+	}
+	if len([]rune(comment)) > maxFeedbackCommentLength {
+		return &InvalidRequestError{Reason: fmt.Sprintf("comment must be at most %d characters", maxFeedbackCommentLength)}
+	}
+
+	found, err := s.db.StoreFeedback(ctx, answerID, rating, comment)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrAnswerNotFound
+	}
+	log.Info(ctx, fmt.Sprintf("recorded %s rating of answer: %s", rating, answerID))
+	return nil
+}
+
+// ListFeedback returns the most recent limit ratings of the given kind, with
+// the answers they rate.
+func (s *Service) ListFeedback(ctx context.Context, rating string, limit int) ([]model.Feedback, error) {
+	if rating != model.RatingUp && rating != model.RatingDown {
+		return nil, &InvalidRequestError{Reason: fmt.Sprintf("rating must be %s or %s", model.RatingUp, model.RatingDown)}
+	}
+	return s.db.ListFeedback(ctx, rating, limit)
+}
@@ -0,0 +1,172 @@
+package rag
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+)
+
+// maxFilterTech caps the tech tags a request can filter on.
+const maxFilterTech = 10
+
+// categoryWords are words that show a question is only about one category of
+// document. Words like "experience" or "work" are left out, since questions
+// like "has he worked with Go?" are about projects too.
+var categoryWords = map[string][]string{
+	model.CategoryProject:    {"project", "projects"},
+	model.CategoryExperience: {"job", "jobs", "role", "roles", "intern", "interns", "internship", "internships", "employer", "employers", "company", "companies", "workplace", "workplaces", "career"},
+}
+
+// resolveFilter validates and normalizes a request's filter.
+func resolveFilter(f model.SearchFilter) (model.SearchFilter, error) {
+	category := strings.ToLower(strings.TrimSpace(f.Category))
+	if category != "" && category != model.CategoryExperience && category != model.CategoryProject {
+		return model.SearchFilter{}, &InvalidRequestError{Reason: fmt.Sprintf("category must be %s or %s", model.CategoryExperience, model.CategoryProject)}
+	}
+
+	var tech []string
+	for _, t := range f.Tech {
+		if t = strings.TrimSpace(t); t != "" {
+			tech = append(tech, t)
+		}
+	}
+	if len(tech) > maxFilterTech {
+		return model.SearchFilter{}, &InvalidRequestError{Reason: fmt.Sprintf("tech must have at most %d tags", maxFilterTech)}
+	}
+
+	return model.SearchFilter{
+		Category:  category,
+		Tech:      tech,
+		Workplace: strings.TrimSpace(f.Workplace),
+	}, nil
+}
+
+// detectFilter infers a filter from the documents a question asks about,
+// e.g. "projects with React" only searches projects tagged React. Tech tags
+// and workplaces are matched against the indexed experiences and projects.
+func (s *Service) detectFilter(question string) model.SearchFilter {
+	var filter model.SearchFilter
+
+	// Longer tags are matched first and cut out of the question, so "React
+	// Native" is not also matched as "React"
+	remaining := question
+	for _, tech := range s.techMentions {
+		if tech.pattern.MatchString(remaining) {
+			filter.Tech = append(filter.Tech, tech.name)
+			remaining = tech.pattern.ReplaceAllString(remaining, " ")
+		}
+	}
+	sort.Strings(filter.Tech)
+
+	var workplaces []string
+	for _, workplace := range s.workplaceMentions {
+		if workplace.pattern.MatchString(question) {
+			workplaces = append(workplaces, workplace.name)
+		}
+	}
+	// A question comparing workplaces needs all of them
+	if len(workplaces) == 1 {
+		filter.Workplace = workplaces[0]
+		return filter
+	}
+
+	filter.Category = questionCategory(question)
+	return filter
+}
+
+// mention is a tech tag or workplace of the corpus, with the pattern that
+// matches it in questions.
+type mention struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// loadMentions compiles the patterns for the tech tags and workplaces of the
+// indexed experiences and projects, so they aren't compiled for every
+// question.
+func (s *Service) loadMentions() {
+	var techMentions []mention
+	for _, tech := range s.techTags() {
+		techMentions = append(techMentions, mention{name: tech, pattern: mentionPattern(tech)})
+	}
+
+	var workplaceMentions []mention
+	seen := make(map[string]struct{})
+	for _, e := range s.experiences {
+		if _, ok := seen[e.Workplace]; ok {
+			continue
+		}
+		seen[e.Workplace] = struct{}{}
+		workplaceMentions = append(workplaceMentions, mention{name: e.Workplace, pattern: mentionPattern(e.Workplace)})
+	}
+
+	s.techMentions = techMentions
+	s.workplaceMentions = workplaceMentions
+}
+
+// techTags returns the distinct tech tags of the indexed experiences and
+// projects, longest first.
+func (s *Service) techTags() []string {
+	var tags []string
+	seen := make(map[string]struct{})
+	add := func(tech []string) {
+		for _, t := range tech {
+			key := strings.ToLower(t)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			tags = append(tags, t)
+		}
+	}
+	for _, e := range s.experiences {
+		add(e.Tech)
+	}
+	for _, p := range s.projects {
+		add(p.Tech)
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		if len(tags[i]) != len(tags[j]) {
+			return len(tags[i]) > len(tags[j])
+		}
+		return tags[i] < tags[j]
+	})
+	return tags
+}
+
+// mentionPattern matches name as a whole word. Case is ignored except for
+// names of two characters or fewer, so "Go" is not matched by the verb "go".
+func mentionPattern(name string) *regexp.Regexp {
+	flags := "(?i)"
+	if len(name) <= 2 {
+		flags = ""
+	}
+	return regexp.MustCompile(flags + `(^|[^\p{L}\p{N}])` + regexp.QuoteMeta(name) + `($|[^\p{L}\p{N}])`)
+}
+
+// questionCategory returns the category a question is limited to, or "" if
+// it mentions neither or both.
+func questionCategory(question string) string {
+	words := strings.FieldsFunc(strings.ToLower(question), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	var found []string
+	for _, category := range []string{model.CategoryExperience, model.CategoryProject} {
+		for _, w := range words {
+			if containsFold(categoryWords[category], w) {
+				found = append(found, category)
+				break
+			}
+		}
+	}
+	if len(found) != 1 {
+		return ""
+	}
+	return found[0]
+}
@@ -0,0 +1,44 @@
+package rag
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+)
+
+func TestDetectFilter(t *testing.T) {
+	s := &Service{
+		experiences: []model.Experience{
+			{Workplace: "SailPoint", Tech: []string{"Go", "Kafka"}},
+			{Workplace: "SailPoint", Tech: []string{"TypeScript"}},
+			{Workplace: "Citi", Tech: []string{"Java"}},
+		},
+		projects: []model.Project{
+			{Name: "ResumeWords", Tech: []string{"React", "React Native"}},
+		},
+	}
+	s.loadMentions()
+
+	tests := []struct {
+		question string
+		want     model.SearchFilter
+	}{
+		{"What did he do?", model.SearchFilter{}},
+		{"Which projects did he build?", model.SearchFilter{Category: model.CategoryProject}},
+		{"What internships has he done?", model.SearchFilter{Category: model.CategoryExperience}},
+		{"Has he used kafka?", model.SearchFilter{Tech: []string{"Kafka"}}},
+		{"Has he used Go and React?", model.SearchFilter{Tech: []string{"Go", "React"}}},
+		{"Did he go to school?", model.SearchFilter{}},
+		{"What did he build with React Native?", model.SearchFilter{Tech: []string{"React Native"}}},
+		{"What did he do at sailpoint?", model.SearchFilter{Workplace: "SailPoint"}},
+		{"Was SailPoint or Citi his favourite job?", model.SearchFilter{Category: model.CategoryExperience}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.question, func(t *testing.T) {
+			if got := s.detectFilter(tt.question); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectFilter(%q) = %+v, want %+v", tt.question, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// GenerationOptions override the configured generation parameters for a
+// single request. Zero values keep the configured defaults.
+type GenerationOptions struct {
+	TopK      int
+	MaxTokens int
+	Model     string
+}
+
+func (o GenerationOptions) isZero() bool {
+	return o == GenerationOptions{}
+}
+
+// InvalidRequestError is returned when a request asks for something the
+// server does not allow.
+type InvalidRequestError struct {
+	Reason string
+}
+
+func (e *InvalidRequestError) Error() string {
+	return "invalid request: " + e.Reason
+}
+
+// Validate checks a request before it is answered, so callers can reject it
+// before committing to a response, e.g. opening an event stream. The returned
+// request should be answered in place of req, as its question may have been
+// sanitized.
+func (s *Service) Validate(ctx context.Context, req Request) (Request, error) {
+	if _, err := s.resolveGeneration(req.Options); err != nil {
+		return req, err
+	}
+	if _, err := resolveFilter(req.Filter); err != nil {
+		return req, err
+	}
+	return s.screen(ctx, req)
+}
+
+// generation holds the parameters used to answer a request.
+type generation struct {
+	// topK documents are always sent, and with a context budget, up to
+	// maxDocuments are sent while they fit
+	topK         int
+	maxDocuments int
+	maxTokens    int
+	model        string
+
+	// questionLanguage is the language the question is written in, and
+	// language the one it is answered in
+	questionLanguage string
+	language         string
+
+	// filter is the request's filter, and is detected from the question if
+	// empty
+	filter model.SearchFilter
+}
+
+// resolveGeneration applies the request's overrides to the configured
+// defaults, rejecting any outside of the server-side limits.
+func (s *Service) resolveGeneration(opts GenerationOptions) (generation, error) {
+	gen := generation{
+		topK:      s.cfg.TopK,
+		maxTokens: s.cfg.MaxTokens,
+		model:     s.cfg.ChatModel,
+	}
+	// With a context budget, documents past top k are sent while they fit,
+	// unless the request sets top k
+	gen.maxDocuments = gen.topK
+	if s.cfg.ContextTokenBudget > 0 {
+		gen.maxDocuments = s.cfg.MaxTopK
+	}
+	if opts.TopK != 0 {
+		if opts.TopK < 1 || opts.TopK > s.cfg.MaxTopK {
+			return generation{}, &InvalidRequestError{Reason: fmt.Sprintf("top_k must be between 1 and %d", s.cfg.MaxTopK)}
+		}
+		gen.topK = opts.TopK
+		gen.maxDocuments = opts.TopK
+	}
+
+	if opts.MaxTokens != 0 {
+		if opts.MaxTokens < 1 || opts.MaxTokens > s.cfg.MaxCompletionTokens {
+			return generation{}, &InvalidRequestError{Reason: fmt.Sprintf("max_tokens must be between 1 and %d", s.cfg.MaxCompletionTokens)}
+		}
+		gen.maxTokens = opts.MaxTokens
+	}
+
+	if opts.Model != "" {
+		allowed := false
+		for _, m := range s.cfg.AllowedChatModels {
+			if m == opts.Model {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return generation{}, &InvalidRequestError{Reason: fmt.Sprintf("model %s is not allowed", opts.Model)}
+		}
+		gen.model = opts.Model
+	}
+
+	return gen, nil
+}
+
+// chatRequest builds the completion request for a pending answer.
+func (s *Service) chatRequest(p *pendingAnswer) openai.ChatCompletionRequest {
+	temperature := s.cfg.Temperature
+	if temperature == 0 {
+		// A zero temperature would be dropped from the request along with
+		// unset ones, see zeroTemperature
+		temperature = zeroTemperature
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model:       p.gen.model,
+		Messages:    p.messages,
+		MaxTokens:   p.gen.maxTokens,
+		Temperature: temperature,
+	}
+	if s.cfg.StructuredAnswers {
+		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		}
+	}
+	return request
+}
@@ -0,0 +1,32 @@
+package rag
+
+import "testing"
+
+func TestResolveGenerationDocuments(t *testing.T) {
+	tests := []struct {
+		name             string
+		budget           int
+		topK             int
+		wantTopK         int
+		wantMaxDocuments int
+		wantErr          bool
+	}{
+		{"budget", 1500, 0, 3, 10, false},
+		{"no budget", 0, 0, 3, 3, false},
+		{"request top k with budget", 1500, 1, 1, 1, false},
+		{"request top k without budget", 0, 5, 5, 5, false},
+		{"request top k over max", 1500, 11, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{cfg: Config{TopK: 3, MaxTopK: 10, ContextTokenBudget: tt.budget}}
+			gen, err := s.resolveGeneration(GenerationOptions{TopK: tt.topK})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveGeneration() error = %v, want error %v", err, tt.wantErr)
+			}
+			if gen.topK != tt.wantTopK || gen.maxDocuments != tt.wantMaxDocuments {
+				t.Errorf("resolveGeneration() top k = %d, max documents = %d, want %d, %d", gen.topK, gen.maxDocuments, tt.wantTopK, tt.wantMaxDocuments)
+			}
+		})
+	}
+}
@@ -0,0 +1,431 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/jcserv/portfolio-api/internal/utils/log"
+	"github.com/pkg/errors"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	ModerationNone   = "none"
+	ModerationOpenAI = "openai"
+	ModerationLLM    = "llm"
+)
+
+// Guardrail checks a generated answer before it is returned. It may rewrite
+// the answer, or return a GuardrailError to have it replaced with the
+// fallback response.
+type Guardrail interface {
+	Name() string
+	Apply(ctx context.Context, answer string) (string, error)
+}
+
+// GuardrailError is returned by a guardrail that rejects an answer.
+type GuardrailError struct {
+	Guardrail string
+	Reason    string
+}
+
+func (e *GuardrailError) Error() string {
+	return fmt.Sprintf("answer failed %s guardrail: %s", e.Guardrail, e.Reason)
+}
+
+// GuardrailConfig configures each guardrail step. Steps that are disabled are
+// left out of the pipeline.
+type GuardrailConfig struct {
+	Moderation string
+
+	RedactContactInfo bool
+	// ContactAllowlist holds emails and phone numbers that may be returned
+	// unredacted, e.g. the owner's public contact details
+	ContactAllowlist []string
+
+	// MaxAnswerLength caps answers, in characters. Zero disables the cap.
+	MaxAnswerLength int
+}
+
+// NewGuardrails builds the guardrail pipeline in the order the steps run:
+// moderation, redaction, then the length cap.
+func NewGuardrails(cfg GuardrailConfig, chat ChatProvider) ([]Guardrail, error) {
+	var guardrails []Guardrail
+
+	switch cfg.Moderation {
+	case ModerationNone, "":
+	case ModerationOpenAI:
+		moderator, ok := chat.(Moderator)
+		if !ok {
+			return nil, fmt.Errorf("%s moderation requires the %s provider", ModerationOpenAI, ProviderOpenAI)
+		}
+		guardrails = append(guardrails, NewModerationGuardrail(moderator))
+	case ModerationLLM:
+		guardrails = append(guardrails, NewModerationGuardrail(NewLLMModerator(chat)))
+	default:
+		return nil, fmt.Errorf("unknown moderation: %s", cfg.Moderation)
+	}
+
+	if cfg.RedactContactInfo {
+		guardrails = append(guardrails, NewRedactionGuardrail(cfg.ContactAllowlist))
+	}
+
+	if cfg.MaxAnswerLength > 0 {
+		guardrails = append(guardrails, NewLengthGuardrail(cfg.MaxAnswerLength))
+	}
+
+	return guardrails, nil
+}
+
+// applyGuardrails runs the answer through each guardrail, returning the
+// fallback response if any of them fails. It reports whether the fallback was
+// used.
+func (s *Service) applyGuardrails(ctx context.Context, answer string) (string, bool) {
+	for _, g := range s.guardrails {
+		guarded, err := g.Apply(ctx, answer)
+		if err != nil {
+			log.Error(ctx, fmt.Sprintf("answer failed %s guardrail, using fallback response: %v", g.Name(), err))
+			return s.cfg.GuardrailFallbackResponse, true
+		}
+		if guarded != answer {
+			// The answer itself is not logged, since it may hold the contact
+			// info that was redacted
+			log.Info(ctx, fmt.Sprintf("%s guardrail changed answer, %d redactions, from %d to %d characters",
+				g.Name(), countRedactions(guarded)-countRedactions(answer), len([]rune(answer)), len([]rune(guarded))))
+		}
+		answer = guarded
+	}
+	return answer, false
+}
+
+// guardExtras applies the guardrails to the follow-up questions and entities
+// of a structured answer, which are shown to the user too. They are redacted
+// like the answer, and checked together by the guardrails that reject answers,
+// such as moderation. If any check fails they are dropped, keeping the answer.
+// The length cap only applies to the answer.
+func (s *Service) guardExtras(ctx context.Context, answer generatedAnswer) generatedAnswer {
+	if len(answer.FollowUpQuestions) == 0 && len(answer.Entities) == 0 {
+		return answer
+	}
+	answer.FollowUpQuestions = slices.Clone(answer.FollowUpQuestions)
+	answer.Entities = slices.Clone(answer.Entities)
+
+	for _, g := range s.guardrails {
+		switch g := g.(type) {
+		case *RedactionGuardrail:
+			for i, q := range answer.FollowUpQuestions {
+				answer.FollowUpQuestions[i] = g.redact(q)
+			}
+			for i, e := range answer.Entities {
+				answer.Entities[i] = model.Entity{Name: g.redact(e.Name), Type: g.redact(e.Type)}
+			}
+		case *LengthGuardrail:
+		default:
+			if _, err := g.Apply(ctx, extrasText(answer)); err != nil {
+				log.Error(ctx, fmt.Sprintf("follow-up questions and entities failed %s guardrail, dropping them: %v", g.Name(), err))
+				answer.FollowUpQuestions = nil
+				answer.Entities = nil
+				return answer
+			}
+		}
+	}
+	return answer
+}
+
+// extrasText joins the follow-up questions and entity names of an answer, one
+// per line, to be checked at once.
+func extrasText(answer generatedAnswer) string {
+	lines := append([]string{}, answer.FollowUpQuestions...)
+	for _, e := range answer.Entities {
+		lines = append(lines, e.Name)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// streamGuard applies guardrails to an answer as it streams, so nothing
+// reaches the client before it is checked. Redaction and the length cap are
+// applied piece by piece, holding back any text an email or phone number could
+// still extend into. Other guardrails, such as moderation, need the full
+// answer, so with any of them the whole answer is held back until it passes.
+type streamGuard struct {
+	onDelta func(string) error
+
+	buffer    bool
+	redaction *RedactionGuardrail
+	// remaining is how many more characters may be sent, or -1 for no cap
+	remaining int
+
+	pending string
+}
+
+func (s *Service) newStreamGuard(onDelta func(string) error) *streamGuard {
+	g := &streamGuard{onDelta: onDelta, remaining: -1}
+	for _, guardrail := range s.guardrails {
+		switch guardrail := guardrail.(type) {
+		case *RedactionGuardrail:
+			g.redaction = guardrail
+		case *LengthGuardrail:
+			g.remaining = guardrail.maxLength
+		default:
+			g.buffer = true
+		}
+	}
+	return g
+}
+
+// Write adds a piece of the streamed answer, sending as much of it as is safe.
+func (g *streamGuard) Write(delta string) error {
+	if g.buffer {
+		return nil
+	}
+	g.pending += delta
+	cut := len(g.pending)
+	if g.redaction != nil {
+		cut = redactionSafeCut(g.pending)
+	}
+	if cut == 0 {
+		return nil
+	}
+	text := g.pending[:cut]
+	g.pending = g.pending[cut:]
+	return g.send(text)
+}
+
+// Flush sends the rest of the answer once it has been generated. When the
+// answer was held back, answer is sent in full, as it has passed the
+// guardrails or been replaced with the fallback response.
+func (g *streamGuard) Flush(answer string) error {
+	if g.buffer {
+		return g.onDelta(answer)
+	}
+	text := g.pending
+	g.pending = ""
+	return g.send(text)
+}
+
+func (g *streamGuard) send(text string) error {
+	if g.redaction != nil {
+		text = g.redaction.redact(text)
+	}
+	if g.remaining >= 0 {
+		runes := []rune(text)
+		if len(runes) > g.remaining {
+			runes = runes[:g.remaining]
+		}
+		g.remaining -= len(runes)
+		text = string(runes)
+	}
+	if text == "" {
+		return nil
+	}
+	return g.onDelta(text)
+}
+
+// phoneChars are the characters a phone number match can contain.
+const phoneChars = "0123456789()+.- \t\n\r\f\v"
+
+// redactionSafeCut returns the length of the longest prefix of text that no
+// email or phone number can extend past. Emails can't contain whitespace and
+// phone numbers can't contain letters, so a prefix is safe if it ends in
+// whitespace after a character no phone number contains.
+func redactionSafeCut(text string) int {
+	for i := len(text) - 1; i >= 1; i-- {
+		if strings.IndexByte(" \t\n\r\f\v", text[i]) >= 0 && strings.IndexByte(phoneChars, text[i-1]) < 0 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Moderator flags text that violates a content policy.
+type Moderator interface {
+	Moderate(ctx context.Context, text string) (bool, error)
+}
+
+// ModerationGuardrail rejects answers flagged by a moderator. Answers are
+// also rejected if moderation fails, since they could not be checked.
+type ModerationGuardrail struct {
+	moderator Moderator
+}
+
+func NewModerationGuardrail(moderator Moderator) *ModerationGuardrail {
+	return &ModerationGuardrail{moderator: moderator}
+}
+
+func (g *ModerationGuardrail) Name() string {
+	return "moderation"
+}
+
+func (g *ModerationGuardrail) Apply(ctx context.Context, answer string) (string, error) {
+	flagged, err := g.moderator.Moderate(ctx, answer)
+	if err != nil {
+		return "", err
+	}
+	if flagged {
+		return "", &GuardrailError{Guardrail: g.Name(), Reason: "answer was flagged by moderation"}
+	}
+	return answer, nil
+}
+
+const llmModerationPrompt = `You moderate answers from a chatbot about a developer's portfolio.
+Flag the answer if it contains hateful, harassing, violent, sexual, self-harm or otherwise unsafe content,
+or content that is clearly unprofessional for a portfolio website.
+Respond with JSON only, in the form {"flagged": true} or {"flagged": false}.`
+
+// LLMModerator asks the chat model to moderate text, for providers without a
+// moderation API.
+type LLMModerator struct {
+	chat ChatProvider
+}
+
+func NewLLMModerator(chat ChatProvider) *LLMModerator {
+	return &LLMModerator{chat: chat}
+}
+
+func (m *LLMModerator) Moderate(ctx context.Context, text string) (bool, error) {
+	completion, err := m.chat.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: llmModerationPrompt,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: text,
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	message, err := firstMessage(completion)
+	if err != nil {
+		return false, err
+	}
+
+	var moderation struct {
+		Flagged bool `json:"flagged"`
+	}
+	if err := json.Unmarshal([]byte(message.Content), &moderation); err != nil {
+		return false, errors.Wrap(err, "failed to parse moderation")
+	}
+	return moderation.Flagged, nil
+}
+
+var (
+	emailRegex = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	// Matches international numbers with a leading +, and North American
+	// numbers without one
+	phoneRegex = regexp.MustCompile(`\+\d[\d\s().-]{7,}\d|(?:\(\d{3}\)|\b\d{3})[\s.-]?\d{3}[\s.-]?\d{4}\b`)
+)
+
+const (
+	redactedEmail = "[redacted email]"
+	redactedPhone = "[redacted phone number]"
+)
+
+// countRedactions counts the redaction placeholders in text.
+func countRedactions(text string) int {
+	return strings.Count(text, redactedEmail) + strings.Count(text, redactedPhone)
+}
+
+// RedactionGuardrail replaces emails and phone numbers that are not
+// allowlisted.
+type RedactionGuardrail struct {
+	emails map[string]struct{}
+	phones map[string]struct{}
+}
+
+func NewRedactionGuardrail(allowlist []string) *RedactionGuardrail {
+	g := &RedactionGuardrail{
+		emails: make(map[string]struct{}),
+		phones: make(map[string]struct{}),
+	}
+	for _, entry := range allowlist {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "@") {
+			g.emails[strings.ToLower(entry)] = struct{}{}
+		} else if digits := phoneDigits(entry); digits != "" {
+			g.phones[digits] = struct{}{}
+		}
+	}
+	return g
+}
+
+func (g *RedactionGuardrail) Name() string {
+	return "redaction"
+}
+
+func (g *RedactionGuardrail) Apply(ctx context.Context, answer string) (string, error) {
+	return g.redact(answer), nil
+}
+
+func (g *RedactionGuardrail) redact(answer string) string {
+	answer = emailRegex.ReplaceAllStringFunc(answer, func(email string) string {
+		if _, ok := g.emails[strings.ToLower(email)]; ok {
+			return email
+		}
+		return redactedEmail
+	})
+	answer = phoneRegex.ReplaceAllStringFunc(answer, func(phone string) string {
+		if _, ok := g.phones[phoneDigits(phone)]; ok {
+			return phone
+		}
+		return redactedPhone
+	})
+	return answer
+}
+
+// phoneDigits normalizes a phone number to its last 10 digits, so numbers
+// match regardless of formatting or country code.
+func phoneDigits(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+	if len(digits) > 10 {
+		digits = digits[len(digits)-10:]
+	}
+	return digits
+}
+
+// LengthGuardrail truncates answers longer than the cap at the last sentence
+// or word boundary before it.
+type LengthGuardrail struct {
+	maxLength int
+}
+
+func NewLengthGuardrail(maxLength int) *LengthGuardrail {
+	return &LengthGuardrail{maxLength: maxLength}
+}
+
+func (g *LengthGuardrail) Name() string {
+	return "length"
+}
+
+func (g *LengthGuardrail) Apply(ctx context.Context, answer string) (string, error) {
+	runes := []rune(answer)
+	if len(runes) <= g.maxLength {
+		return answer, nil
+	}
+
+	truncated := string(runes[:g.maxLength])
+	if i := strings.LastIndexAny(truncated, ".!?\n"); i > len(truncated)/2 {
+		return strings.TrimSpace(truncated[:i+1]), nil
+	}
+	if i := strings.LastIndexAny(truncated, " \t"); i > 0 {
+		truncated = truncated[:i]
+	}
+	return strings.TrimSpace(truncated) + "…", nil
+}
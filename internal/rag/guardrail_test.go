@@ -0,0 +1,195 @@
+package rag
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+)
+
+func TestRedactionGuardrail(t *testing.T) {
+	g := NewRedactionGuardrail([]string{"Owner@Example.com", "+1 (416) 555-0100"})
+
+	tests := []struct {
+		name   string
+		answer string
+		want   string
+	}{
+		{"no contact info", "He worked at SailPoint.", "He worked at SailPoint."},
+		{"email", "Email jane@corp.io for details.", "Email [redacted email] for details."},
+		{"allowlisted email", "Email owner@example.com for details.", "Email owner@example.com for details."},
+		{"phone", "Call 647-555-0199 today.", "Call [redacted phone number] today."},
+		{"phone in parentheses", "Call (647) 555 0199.", "Call [redacted phone number]."},
+		{"international phone", "Call +44 20 7946 0958.", "Call [redacted phone number]."},
+		{"allowlisted phone", "Call 416.555.0100 today.", "Call 416.555.0100 today."},
+		{"allowlisted phone without country code", "Call (416) 555-0100.", "Call (416) 555-0100."},
+		{"mixed", "Reach owner@example.com or bob@corp.io, or 647 555 0199.",
+			"Reach owner@example.com or [redacted email], or [redacted phone number]."},
+		{"year range", "From 2019 to 2023.", "From 2019 to 2023."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.Apply(context.Background(), tt.answer)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Apply(%q) = %q, want %q", tt.answer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLengthGuardrail(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxLength int
+		answer    string
+		want      string
+	}{
+		{"under the cap", 50, "Short answer.", "Short answer."},
+		{"at a sentence", 30, "First sentence here. Second sentence here.", "First sentence here."},
+		{"at a word", 20, "one two three four five six seven", "one two three four…"},
+		{"multibyte", 4, "héllo wörld", "héll…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewLengthGuardrail(tt.maxLength).Apply(context.Background(), tt.answer)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Apply(%q) = %q, want %q", tt.answer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactionSafeCut(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"no whitespace", len("no ")},
+		{"contact me at ", len("contact me at ")},
+		{"contact jane@corp", len("contact ")},
+		{"call 647 555 ", len("call ")},
+		{"call (647) ", len("call ")},
+		{"ends a sentence. ", len("ends a ")},
+	}
+	for _, tt := range tests {
+		if got := redactionSafeCut(tt.text); got != tt.want {
+			t.Errorf("redactionSafeCut(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+// flaggingGuardrail rejects every answer, standing in for moderation.
+type flaggingGuardrail struct{}
+
+func (flaggingGuardrail) Name() string { return "flagging" }
+
+func (flaggingGuardrail) Apply(ctx context.Context, answer string) (string, error) {
+	return "", &GuardrailError{Guardrail: "flagging", Reason: "flagged"}
+}
+
+func TestStreamGuard(t *testing.T) {
+	redaction := NewRedactionGuardrail([]string{"owner@example.com"})
+	answer := "Email jane@corp.io or owner@example.com, or call 647-555-0199. Thanks"
+
+	tests := []struct {
+		name       string
+		guardrails []Guardrail
+		final      string
+		want       string
+	}{
+		{"no guardrails", nil, answer, answer},
+		{"redaction", []Guardrail{redaction}, answer,
+			"Email [redacted email] or owner@example.com, or call [redacted phone number]. Thanks"},
+		{"redaction and length", []Guardrail{redaction, NewLengthGuardrail(12)}, answer, "Email [redac"},
+		{"moderation", []Guardrail{flaggingGuardrail{}, redaction}, "fallback", "fallback"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every way of splitting the answer in two, plus one rune at a time
+			var splits [][]string
+			for i := 0; i <= len(answer); i++ {
+				splits = append(splits, []string{answer[:i], answer[i:]})
+			}
+			splits = append(splits, strings.SplitAfter(answer, ""))
+
+			for _, chunks := range splits {
+				var sent []string
+				s := &Service{guardrails: tt.guardrails}
+				g := s.newStreamGuard(func(delta string) error {
+					sent = append(sent, delta)
+					return nil
+				})
+				for _, chunk := range chunks {
+					if err := g.Write(chunk); err != nil {
+						t.Fatalf("Write() error = %v", err)
+					}
+				}
+				if err := g.Flush(tt.final); err != nil {
+					t.Fatalf("Flush() error = %v", err)
+				}
+
+				got := strings.Join(sent, "")
+				if got != tt.want {
+					t.Fatalf("streamed %q from chunks %q, want %q", got, chunks, tt.want)
+				}
+				for _, delta := range sent {
+					if strings.Contains(delta, "jane") || strings.Contains(delta, "0199") {
+						if tt.guardrails != nil {
+							t.Fatalf("sent unredacted delta %q from chunks %q", delta, chunks)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGuardExtras(t *testing.T) {
+	redaction := NewRedactionGuardrail([]string{"owner@example.com"})
+	answer := generatedAnswer{
+		Text:              "He worked at SailPoint.",
+		FollowUpQuestions: []string{"Should I email jane@corp.io?", "Can I reach him at owner@example.com?", "What did he build with Kafka?"},
+		Entities:          []model.Entity{{Name: "SailPoint", Type: "experience"}, {Name: "647-555-0199", Type: "contact"}},
+	}
+
+	tests := []struct {
+		name          string
+		guardrails    []Guardrail
+		wantFollowUps []string
+		wantEntities  []model.Entity
+	}{
+		{"no guardrails", nil, answer.FollowUpQuestions, answer.Entities},
+		{"redaction", []Guardrail{redaction},
+			[]string{"Should I email [redacted email]?", "Can I reach him at owner@example.com?", "What did he build with Kafka?"},
+			[]model.Entity{{Name: "SailPoint", Type: "experience"}, {Name: "[redacted phone number]", Type: "contact"}}},
+		{"length", []Guardrail{NewLengthGuardrail(5)}, answer.FollowUpQuestions, answer.Entities},
+		{"moderation", []Guardrail{flaggingGuardrail{}, redaction}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{guardrails: tt.guardrails}
+			got := s.guardExtras(context.Background(), answer)
+			if !reflect.DeepEqual(got.FollowUpQuestions, tt.wantFollowUps) {
+				t.Errorf("follow-up questions = %q, want %q", got.FollowUpQuestions, tt.wantFollowUps)
+			}
+			if !reflect.DeepEqual(got.Entities, tt.wantEntities) {
+				t.Errorf("entities = %v, want %v", got.Entities, tt.wantEntities)
+			}
+			if got.Text != answer.Text {
+				t.Errorf("text = %q, want %q", got.Text, answer.Text)
+			}
+		})
+	}
+	if answer.FollowUpQuestions[0] != "Should I email jane@corp.io?" {
+		t.Errorf("guardExtras() changed the original follow-up questions")
+	}
+}
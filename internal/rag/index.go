@@ -0,0 +1,172 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/jcserv/portfolio-api/internal/db"
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/jcserv/portfolio-api/internal/utils"
+	"github.com/jcserv/portfolio-api/internal/utils/log"
+)
+
+// IndexSummary counts the documents changed by indexing the corpus.
+type IndexSummary struct {
+	Added     int
+	Updated   int
+	Removed   int
+	Unchanged int
+}
+
+func (s IndexSummary) String() string {
+	return fmt.Sprintf("%d added, %d updated, %d removed, %d unchanged", s.Added, s.Updated, s.Removed, s.Unchanged)
+}
+
+// corpusDocument is a document of the corpus along with the texts of its
+// chunks.
+type corpusDocument struct {
+	doc    model.Document
+	chunks []string
+}
+
+// IndexCorpus reconciles the index with the corpus. Each document is matched
+// to the indexed one with the same source key: new documents are added,
+// changed ones are replaced, and indexed documents no longer in the corpus
+// are removed, along with their embeddings. Only added and changed documents
+// are embedded, before the changes are stored in a single transaction.
+func (s *Service) IndexCorpus(ctx context.Context, experiences []model.Experience, projects []model.Project) (IndexSummary, error) {
+	s.experiences = experiences
+	s.projects = projects
+	s.loadMentions()
+
+	indexed, err := s.db.ListDocuments(ctx)
+	if err != nil {
+		return IndexSummary{}, err
+	}
+	bySourceKey := make(map[string]model.Document, len(indexed))
+	for _, doc := range indexed {
+		if doc.SourceKey != "" {
+			bySourceKey[doc.SourceKey] = doc
+		}
+	}
+
+	var summary IndexSummary
+	var add, update []db.IndexedDocument
+	kept := make(map[int64]struct{})
+	for _, c := range corpusDocuments(experiences, projects) {
+		existing, ok := bySourceKey[c.doc.SourceKey]
+		if ok {
+			kept[existing.ID] = struct{}{}
+			if !documentChanged(existing, c.doc) {
+				summary.Unchanged++
+				continue
+			}
+		}
+
+		chunks, err := s.embedChunks(ctx, c.chunks)
+		if err != nil {
+			return IndexSummary{}, err
+		}
+		if ok {
+			c.doc.ID = existing.ID
+			log.Info(ctx, fmt.Sprintf("updating document: %s", c.doc.SourceKey))
+			update = append(update, db.IndexedDocument{Document: c.doc, Chunks: chunks})
+			continue
+		}
+		add = append(add, db.IndexedDocument{Document: c.doc, Chunks: chunks})
+	}
+
+	var remove []int64
+	for _, doc := range indexed {
+		if _, ok := kept[doc.ID]; ok {
+			continue
+		}
+		source := doc.SourceKey
+		if source == "" {
+			source = doc.Title + " (no source key)"
+		}
+		log.Info(ctx, fmt.Sprintf("removing document: %s", source))
+		remove = append(remove, doc.ID)
+	}
+
+	if err := s.db.SyncDocuments(ctx, add, update, remove); err != nil {
+		return IndexSummary{}, err
+	}
+	summary.Added, summary.Updated, summary.Removed = len(add), len(update), len(remove)
+	log.Info(ctx, fmt.Sprintf("indexed corpus: %s", summary))
+	return summary, nil
+}
+
+// corpusDocuments builds the documents of the corpus, keyed by the file they
+// are read from and their workplace or name. Entries sharing a key, e.g. two
+// roles at one workplace, are numbered in the order they appear.
+func corpusDocuments(experiences []model.Experience, projects []model.Project) []corpusDocument {
+	docs := make([]corpusDocument, 0, len(experiences)+len(projects))
+	seen := make(map[string]int)
+	sourceKey := func(file, name string) string {
+		key := filepath.Base(file) + ":" + name
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			key = fmt.Sprintf("%s#%d", key, n)
+		}
+		return key
+	}
+
+	for _, exp := range experiences {
+		docs = append(docs, corpusDocument{
+			doc: model.Document{
+				Category:  model.CategoryExperience,
+				Title:     exp.Title(),
+				Text:      exp.String(),
+				Tech:      exp.Tech,
+				Workplace: exp.Workplace,
+				SourceKey: sourceKey(utils.ExperienceFile, exp.Workplace),
+			},
+			chunks: chunkExperience(exp),
+		})
+	}
+	for _, proj := range projects {
+		docs = append(docs, corpusDocument{
+			doc: model.Document{
+				Category:  model.CategoryProject,
+				Title:     proj.Title(),
+				Text:      proj.String(),
+				Tech:      proj.Tech,
+				SourceKey: sourceKey(utils.ProjectsFile, proj.Name),
+			},
+			chunks: chunkProject(proj),
+		})
+	}
+	return docs
+}
+
+// documentChanged reports whether a corpus document differs from its indexed
+// version. Chunks are built from the same fields, so they only change with
+// the document.
+func documentChanged(indexed, doc model.Document) bool {
+	if indexed.Category != doc.Category || indexed.Title != doc.Title || indexed.Text != doc.Text || indexed.Workplace != doc.Workplace {
+		return true
+	}
+	if len(indexed.Tech) != len(doc.Tech) {
+		return true
+	}
+	for i := range doc.Tech {
+		if indexed.Tech[i] != doc.Tech[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) embedChunks(ctx context.Context, texts []string) ([]model.Chunk, error) {
+	chunks := make([]model.Chunk, 0, len(texts))
+	for _, text := range texts {
+		embedding, err := s.embedder.GetEmbedding(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, model.Chunk{Text: text, Embedding: embedding})
+	}
+	return chunks, nil
+}
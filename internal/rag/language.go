@@ -0,0 +1,192 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/jcserv/portfolio-api/internal/utils/log"
+)
+
+// DefaultLanguage is the language of the indexed documents, and the language
+// assumed when a question's language can't be detected.
+const DefaultLanguage = "en"
+
+const translationPrompt = `Translate the question about a developer's portfolio into English.
+Keep names of people, companies, projects and technologies unchanged.
+Only return the translated question.`
+
+const answerLanguagePrompt = `The user is writing in %s. Write the answer, and any follow-up questions, in %s.
+Keep names of people, companies, projects and technologies unchanged.`
+
+var languageNames = map[string]string{
+	"ar": "Arabic",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nl": "Dutch",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"th": "Thai",
+	"zh": "Chinese",
+}
+
+// scriptLanguages maps scripts used by a single language in languageNames to
+// that language. Han is handled separately, since Japanese also uses it.
+var scriptLanguages = []struct {
+	script   *unicode.RangeTable
+	language string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Thai, "th"},
+}
+
+// latinStopwords are common words in questions, used to tell apart languages
+// written in the Latin script.
+var latinStopwords = map[string][]string{
+	"en": {"the", "a", "an", "it", "he", "what", "is", "are", "was", "were", "did", "does", "do", "has", "have", "had", "can", "could", "would", "will", "be", "been", "how", "why", "which", "who", "where", "when", "with", "and", "or", "of", "in", "on", "for", "from", "by", "at", "to", "about", "his", "him", "any", "this", "that", "tell", "me", "work", "worked", "projects", "experience", "many"},
+	"fr": {"le", "la", "les", "des", "du", "est", "quel", "quelle", "quels", "quelles", "qu", "quoi", "avec", "pour", "sur", "dans", "il", "ses", "son", "chez", "travaillé", "projets", "expérience", "comment", "où", "pourquoi", "combien", "fait", "ce"},
+	"es": {"el", "los", "las", "qué", "cuál", "cuáles", "con", "para", "por", "ha", "trabajado", "proyectos", "experiencia", "cómo", "dónde", "sus", "cuántos", "cuántas", "hizo", "del", "y"},
+	"de": {"der", "die", "das", "und", "ist", "hat", "was", "welche", "welcher", "wie", "wo", "mit", "für", "auf", "bei", "seine", "sein", "projekte", "erfahrung", "gearbeitet", "ein", "eine", "viele", "gemacht"},
+	"pt": {"os", "qual", "quais", "com", "é", "tem", "trabalhou", "projetos", "experiência", "onde", "em", "uma", "um", "seus", "quantos", "quantas", "fez", "da", "do", "não"},
+	"it": {"il", "lo", "gli", "che", "quale", "quali", "è", "lavorato", "progetti", "esperienza", "dove", "suoi", "quanti", "quante", "fatto", "della", "cosa", "ha"},
+	"nl": {"het", "een", "en", "heeft", "wat", "welke", "hoe", "waar", "met", "voor", "op", "bij", "zijn", "projecten", "ervaring", "gewerkt", "hoeveel"},
+}
+
+// latinLanguages is the order latinStopwords are scored in, so ties go to
+// the earlier language.
+var latinLanguages = []string{"en", "fr", "es", "de", "pt", "it", "nl"}
+
+// minLanguageMargin is how many more stopwords than English a question needs
+// to be detected as another Latin-script language, since short English
+// questions share words like "was" with other languages.
+const minLanguageMargin = 2
+
+// minScriptLetters is how many letters of a non-Latin script a question needs
+// to be identified by script when most of its letters are Latin, as they are
+// in names like "SailPoint".
+const minScriptLetters = 3
+
+// detectLanguage returns the code of the language a question is written in,
+// or DefaultLanguage if it can't tell. Non-Latin scripts are identified by
+// script, and Latin-script languages by their common words.
+func detectLanguage(question string) string {
+	var letters, latin, han, kana int
+	scripts := make(map[string]int)
+	for _, r := range question {
+		// Vowel signs, as in Devanagari, are marks rather than letters
+		if !unicode.IsLetter(r) && !unicode.IsMark(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		default:
+			for _, s := range scriptLanguages {
+				if unicode.Is(s.script, r) {
+					scripts[s.language]++
+					break
+				}
+			}
+		}
+	}
+	if letters == 0 {
+		return DefaultLanguage
+	}
+
+	// Names of companies and technologies are written in Latin script
+	// whatever the language, so other scripts are compared among themselves
+	if other := letters - latin; other >= minScriptLetters || other*2 >= letters {
+		// Japanese mixes kana with Han, while Chinese is Han alone
+		if kana > 0 && (kana+han)*2 >= other {
+			return "ja"
+		}
+		if han*2 >= other {
+			return "zh"
+		}
+		for _, s := range scriptLanguages {
+			if scripts[s.language]*2 >= other {
+				return s.language
+			}
+		}
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(question), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	scores := make(map[string]int, len(latinLanguages))
+	best := DefaultLanguage
+	for _, language := range latinLanguages {
+		for _, w := range words {
+			for _, stopword := range latinStopwords[language] {
+				if w == stopword {
+					scores[language]++
+					break
+				}
+			}
+		}
+		if scores[language] > scores[best] {
+			best = language
+		}
+	}
+	if scores[best] < scores[DefaultLanguage]+minLanguageMargin {
+		return DefaultLanguage
+	}
+	return best
+}
+
+// languageName returns the English name of a language code, or the code if
+// it isn't known.
+func languageName(code string) string {
+	if name, ok := languageNames[code]; ok {
+		return name
+	}
+	return code
+}
+
+// resolveLanguages returns the language a question is written in and the
+// language to answer it in, which is req.Language if set.
+func (s *Service) resolveLanguages(req Request) (question, answer string) {
+	question = DefaultLanguage
+	if s.cfg.LanguageDetection {
+		question = detectLanguage(req.Question)
+	}
+	answer = question
+	if req.Language != "" {
+		answer = req.Language
+	}
+	return question, answer
+}
+
+// translateQuestion translates a question into the language of the indexed
+// documents for retrieval, returning it unchanged if translation fails.
+func (s *Service) translateQuestion(ctx context.Context, question string) string {
+	translated, err := s.complete(ctx, translationPrompt, question)
+	if err != nil {
+		log.Error(ctx, fmt.Sprintf("unable to translate question: %v", err))
+		return question
+	}
+	if translated == "" || translated == question {
+		return question
+	}
+	log.Info(ctx, fmt.Sprintf("translated question: %s as: %s", question, translated))
+	return translated
+}
@@ -0,0 +1,58 @@
+package rag
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		question string
+		want     string
+	}{
+		{"empty", "", DefaultLanguage},
+		{"no letters", "?? 123", DefaultLanguage},
+		{"english", "What projects has he worked on with React?", "en"},
+		{"names only", "SailPoint Kafka", DefaultLanguage},
+		{"english shares words with german", "Was Jarrod an intern?", "en"},
+		{"one french word", "Projets?", DefaultLanguage},
+		{"french", "Quels projets a-t-il fait avec React ?", "fr"},
+		{"spanish", "¿Qué proyectos ha hecho con React?", "es"},
+		{"german", "Welche Projekte hat er mit React gemacht?", "de"},
+		{"portuguese", "Quais projetos ele fez com React?", "pt"},
+		{"italian", "Quali progetti ha fatto con React?", "it"},
+		{"dutch", "Welke projecten heeft hij met React gedaan?", "nl"},
+		{"chinese", "他在SailPoint做了什么？", "zh"},
+		{"japanese", "彼はSailPointで何をしましたか？", "ja"},
+		{"korean", "그는 SailPoint에서 무엇을 했나요?", "ko"},
+		{"russian", "Что он делал в SailPoint?", "ru"},
+		{"arabic", "ماذا فعل في SailPoint؟", "ar"},
+		{"hindi", "उसने SailPoint में क्या किया?", "hi"},
+		{"greek", "Τι έκανε στη SailPoint;", "el"},
+		{"hebrew", "מה הוא עשה ב-SailPoint?", "he"},
+		{"thai", "เขาทำอะไรที่ SailPoint", "th"},
+		{"one greek letter", "What is the λ in MMR?", "en"},
+		{"russian with names", "SailPoint Kafka Kubernetes что", "ru"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectLanguage(tt.question); got != tt.want {
+				t.Errorf("detectLanguage(%q) = %q, want %q", tt.question, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLanguageName(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"en", "English"},
+		{"ja", "Japanese"},
+		{"xx", "xx"},
+	}
+	for _, tt := range tests {
+		if got := languageName(tt.code); got != tt.want {
+			t.Errorf("languageName(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	LocalChatModel      = "local-extractive"
+	LocalEmbeddingModel = "local-hashed-bow-512"
+
+	localEmbeddingDimensions = 512
+	localMaxPassages         = 3
+)
+
+// LocalProvider runs the whole pipeline without network access. Embeddings
+// are hashed bag-of-words vectors, and answers are the passages of the
+// retrieved context that best overlap the question.
+type LocalProvider struct{}
+
+func NewLocalProvider() *LocalProvider {
+	return &LocalProvider{}
+}
+
+func (p *LocalProvider) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	counts := make(map[string]int)
+	for _, t := range terms(text) {
+		counts[t]++
+	}
+
+	embedding := make([]float32, localEmbeddingDimensions)
+	for term, count := range counts {
+		h := fnv.New64a()
+		h.Write([]byte(term))
+		sum := h.Sum64()
+
+		weight := float32(1 + math.Log(float64(count)))
+		// The top bit picks the sign so colliding terms tend to cancel out
+		// instead of piling up in one bucket
+		if sum>>63 == 1 {
+			weight = -weight
+		}
+		embedding[sum%localEmbeddingDimensions] += weight
+	}
+
+	var norm float64
+	for _, v := range embedding {
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range embedding {
+			embedding[i] *= scale
+		}
+	}
+	return embedding, nil
+}
+
+func (p *LocalProvider) EmbeddingModel() string {
+	return LocalEmbeddingModel
+}
+
+func (p *LocalProvider) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	content, err := localReply(request)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	return openai.ChatCompletionResponse{
+		Model: LocalChatModel,
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Message: openai.ChatCompletionMessage{
+					Role:    openai.ChatMessageRoleAssistant,
+					Content: content,
+				},
+				FinishReason: openai.FinishReasonStop,
+			},
+		},
+	}, nil
+}
+
+func (p *LocalProvider) CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (ChatStream, error) {
+	content, err := localReply(request)
+	if err != nil {
+		return nil, err
+	}
+	return &localChatStream{chunks: strings.SplitAfter(content, " ")}, nil
+}
+
+// Capabilities reports neither tools nor generation, since extractive answers
+// only quote the prompt.
+func (p *LocalProvider) Capabilities() ChatCapabilities {
+	return ChatCapabilities{}
+}
+
+// localReply returns the extractive answer to a request, as a structured
+// answer if JSON was requested.
+func localReply(request openai.ChatCompletionRequest) (string, error) {
+	answer, titles, ok := extractiveAnswer(request.Messages)
+	format := request.ResponseFormat
+	if !ok || format == nil || format.Type != openai.ChatCompletionResponseFormatTypeJSONObject {
+		return answer, nil
+	}
+
+	structured := structuredAnswer{Answer: answer, Entities: titles}
+	for _, title := range titles {
+		structured.FollowUpQuestions = append(structured.FollowUpQuestions, "Tell me more about "+title)
+	}
+	if len(titles) > 0 {
+		structured.FollowUpQuestions = append(structured.FollowUpQuestions, "What technologies were used at "+titles[0]+"?")
+	}
+	structured.FollowUpQuestions = append(structured.FollowUpQuestions,
+		"What projects are in the portfolio?",
+		"What work experience is in the portfolio?",
+	)
+	structured.FollowUpQuestions = structured.FollowUpQuestions[:min(len(structured.FollowUpQuestions), maxFollowUpQuestions)]
+
+	content, err := json.Marshal(structured)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// extractiveAnswer answers the last user message. When it holds retrieved
+// context followed by the question delimiter, the context lines sharing the
+// most terms with the question are returned along with the titles of the
+// documents they are from. Any other prompt is echoed back, and ok is false.
+func extractiveAnswer(messages []openai.ChatCompletionMessage) (answer string, titles []string, ok bool) {
+	var content string
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == openai.ChatMessageRoleUser {
+			content = messages[i].Content
+			break
+		}
+	}
+
+	i := strings.LastIndex(content, questionDelimiter)
+	if i < 0 {
+		return strings.TrimSpace(content), nil, false
+	}
+	question := content[i+len(questionDelimiter):]
+
+	type passage struct {
+		text  string
+		title string
+		index int
+		score int
+	}
+	var passages []passage
+	var title string
+	docs := strings.ReplaceAll(content[:i], `\n`, "\n")
+	for _, line := range strings.Split(docs, "\n") {
+		line = strings.TrimSpace(line)
+		// Skip blank lines and prompt headings such as "Relevant information:"
+		if line == "" || strings.HasSuffix(line, ":") {
+			continue
+		}
+		// Documents start with "<title> - ", and bullets with "- "
+		if j := strings.Index(line, " - "); j > 0 && !strings.HasPrefix(line, "- ") {
+			title = line[:j]
+		}
+		passages = append(passages, passage{text: line, title: title, index: len(passages)})
+	}
+	if len(passages) == 0 {
+		return "I couldn't find anything relevant to that question.", nil, true
+	}
+
+	questionTerms := termSet(question)
+	for i := range passages {
+		for t := range termSet(passages[i].text) {
+			if _, ok := questionTerms[t]; ok {
+				passages[i].score++
+			}
+		}
+	}
+
+	// Stable so ties, including no overlap at all, keep retrieval order
+	sort.SliceStable(passages, func(i, j int) bool {
+		return passages[i].score > passages[j].score
+	})
+	if len(passages) > localMaxPassages {
+		passages = passages[:localMaxPassages]
+	}
+	sort.Slice(passages, func(i, j int) bool {
+		return passages[i].index < passages[j].index
+	})
+
+	lines := make([]string, 0, len(passages))
+	seen := make(map[string]struct{})
+	for _, p := range passages {
+		lines = append(lines, p.text)
+		if _, ok := seen[p.title]; ok || p.title == "" {
+			continue
+		}
+		seen[p.title] = struct{}{}
+		titles = append(titles, p.title)
+	}
+	return "Here is what I found:\n" + strings.Join(lines, "\n"), titles, true
+}
+
+type localChatStream struct {
+	chunks []string
+}
+
+func (s *localChatStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	if len(s.chunks) == 0 {
+		return openai.ChatCompletionStreamResponse{}, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return openai.ChatCompletionStreamResponse{
+		Model: LocalChatModel,
+		Choices: []openai.ChatCompletionStreamChoice{
+			{Delta: openai.ChatCompletionStreamChoiceDelta{Content: chunk}},
+		},
+	}, nil
+}
+
+func (s *localChatStream) Close() error {
+	return nil
+}
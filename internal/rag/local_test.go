@@ -0,0 +1,45 @@
+package rag
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestLocalReplyFollowUpQuestions(t *testing.T) {
+	tests := []struct {
+		name    string
+		context string
+		want    int
+	}{
+		{"no documents", "Relevant information:\n", 2},
+		{"untitled passages", "- a bullet without a document\n", 2},
+		{"one document", "mjurl - A URL shortener\n- Go\n", 3},
+		{"two documents", "mjurl - A URL shortener\nvu-mi - A view counter\n", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := openai.ChatCompletionRequest{
+				Messages: []openai.ChatCompletionMessage{{
+					Role:    openai.ChatMessageRoleUser,
+					Content: tt.context + questionDelimiter + "\nWhat is mjurl?",
+				}},
+				ResponseFormat: &openai.ChatCompletionResponseFormat{
+					Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+				},
+			}
+			content, err := localReply(request)
+			if err != nil {
+				t.Fatalf("localReply() error = %v", err)
+			}
+			var answer structuredAnswer
+			if err := json.Unmarshal([]byte(content), &answer); err != nil {
+				t.Fatalf("localReply() returned invalid JSON: %v", err)
+			}
+			if len(answer.FollowUpQuestions) != tt.want {
+				t.Errorf("localReply() returned %d follow-up questions, want %d", len(answer.FollowUpQuestions), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jcserv/portfolio-api/internal/api/ollama"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	DefaultOllamaChatModel      = "llama3.2"
+	DefaultOllamaEmbeddingModel = "nomic-embed-text"
+)
+
+// OllamaProvider serves embeddings and chat from a local Ollama server.
+type OllamaProvider struct {
+	client         *ollama.Client
+	chatModel      string
+	embeddingModel string
+}
+
+func NewOllamaProvider(client *ollama.Client, chatModel, embeddingModel string) *OllamaProvider {
+	return &OllamaProvider{
+		client:         client,
+		chatModel:      chatModel,
+		embeddingModel: embeddingModel,
+	}
+}
+
+func (p *OllamaProvider) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	resp, err := p.client.Embed(ctx, ollama.EmbedRequest{
+		Model: p.embeddingModel,
+		Input: []string{text},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) == 0 {
+		return nil, errors.New("ollama returned no embeddings")
+	}
+	return resp.Embeddings[0], nil
+}
+
+func (p *OllamaProvider) EmbeddingModel() string {
+	return p.embeddingModel
+}
+
+func (p *OllamaProvider) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	resp, err := p.client.Chat(ctx, p.toChatRequest(request))
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	return openai.ChatCompletionResponse{
+		Model: resp.Model,
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Message: openai.ChatCompletionMessage{
+					Role:      openai.ChatMessageRoleAssistant,
+					Content:   resp.Message.Content,
+					ToolCalls: fromOllamaToolCalls(resp.Message.ToolCalls, 0),
+				},
+				FinishReason: openai.FinishReasonStop,
+			},
+		},
+		Usage: openai.Usage{
+			PromptTokens:     resp.PromptEvalCount,
+			CompletionTokens: resp.EvalCount,
+			TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+		},
+	}, nil
+}
+
+func (p *OllamaProvider) CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (ChatStream, error) {
+	stream, err := p.client.ChatStream(ctx, p.toChatRequest(request))
+	if err != nil {
+		return nil, err
+	}
+	return &ollamaChatStream{stream: stream}, nil
+}
+
+func (p *OllamaProvider) Capabilities() ChatCapabilities {
+	return ChatCapabilities{Tools: true, Generative: true}
+}
+
+func (p *OllamaProvider) toChatRequest(request openai.ChatCompletionRequest) ollama.ChatRequest {
+	model := request.Model
+	if model == "" {
+		model = p.chatModel
+	}
+
+	messages := make([]ollama.Message, 0, len(request.Messages))
+	for _, m := range request.Messages {
+		message := ollama.Message{Role: m.Role, Content: m.Content}
+		for _, call := range m.ToolCalls {
+			// Arguments that aren't JSON were rejected when the tool was
+			// called, so they are sent back empty
+			var args map[string]any
+			json.Unmarshal([]byte(call.Function.Arguments), &args)
+			message.ToolCalls = append(message.ToolCalls, ollama.ToolCall{
+				Function: ollama.ToolCallFunction{Name: call.Function.Name, Arguments: args},
+			})
+		}
+		messages = append(messages, message)
+	}
+
+	req := ollama.ChatRequest{
+		Model:    model,
+		Messages: messages,
+	}
+	// Ollama has no tool choice, so tools are only sent while they may be
+	// called
+	if request.ToolChoice != "none" {
+		for _, tool := range request.Tools {
+			req.Tools = append(req.Tools, ollama.Tool{
+				Type: string(tool.Type),
+				Function: ollama.ToolFunction{
+					Name:        tool.Function.Name,
+					Description: tool.Function.Description,
+					Parameters:  tool.Function.Parameters,
+				},
+			})
+		}
+	}
+	if request.Temperature != 0 || request.MaxTokens != 0 {
+		req.Options = &ollama.Options{NumPredict: request.MaxTokens}
+		if request.Temperature != 0 {
+			temperature := request.Temperature
+			if temperature == zeroTemperature {
+				temperature = 0
+			}
+			req.Options.Temperature = &temperature
+		}
+	}
+	if request.ResponseFormat != nil && request.ResponseFormat.Type == openai.ChatCompletionResponseFormatTypeJSONObject {
+		req.Format = "json"
+	}
+	return req
+}
+
+type ollamaChatStream struct {
+	stream *ollama.ChatStream
+	// toolCalls is how many tool calls have been streamed
+	toolCalls int
+}
+
+func (s *ollamaChatStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	chunk, err := s.stream.Recv()
+	if err != nil {
+		return openai.ChatCompletionStreamResponse{}, err
+	}
+
+	choice := openai.ChatCompletionStreamChoice{
+		Delta: openai.ChatCompletionStreamChoiceDelta{
+			Content:   chunk.Message.Content,
+			ToolCalls: fromOllamaToolCalls(chunk.Message.ToolCalls, s.toolCalls),
+		},
+	}
+	s.toolCalls += len(chunk.Message.ToolCalls)
+	if chunk.Done {
+		choice.FinishReason = openai.FinishReasonStop
+	}
+	return openai.ChatCompletionStreamResponse{
+		Model:   chunk.Model,
+		Choices: []openai.ChatCompletionStreamChoice{choice},
+	}, nil
+}
+
+func (s *ollamaChatStream) Close() error {
+	return s.stream.Close()
+}
+
+// fromOllamaToolCalls converts tool calls to the OpenAI shape. Ollama does not
+// identify calls or stream their arguments, so calls are identified by their
+// position, counting from offset, and each arrives whole.
+func fromOllamaToolCalls(calls []ollama.ToolCall, offset int) []openai.ToolCall {
+	var converted []openai.ToolCall
+	for i, call := range calls {
+		i += offset
+		args, err := json.Marshal(call.Function.Arguments)
+		if err != nil {
+			args = []byte("{}")
+		}
+		index := i
+		converted = append(converted, openai.ToolCall{
+			Index: &index,
+			ID:    fmt.Sprintf("call_%d", i),
+			Type:  openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      call.Function.Name,
+				Arguments: string(args),
+			},
+		})
+	}
+	return converted
+}
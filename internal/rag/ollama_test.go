@@ -0,0 +1,34 @@
+package rag
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestOllamaTemperature(t *testing.T) {
+	tests := []struct {
+		name        string
+		temperature float32
+		wantSent    bool
+		want        float32
+	}{
+		{"unset", 0, false, 0},
+		{"zero", zeroTemperature, true, 0},
+		{"nonzero", 0.7, true, 0.7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewOllamaProvider(nil, DefaultOllamaChatModel, DefaultOllamaEmbeddingModel)
+			req := p.toChatRequest(openai.ChatCompletionRequest{Temperature: tt.temperature})
+
+			sent := req.Options != nil && req.Options.Temperature != nil
+			if sent != tt.wantSent {
+				t.Fatalf("toChatRequest() sent temperature = %v, want %v", sent, tt.wantSent)
+			}
+			if sent && *req.Options.Temperature != tt.want {
+				t.Errorf("toChatRequest() temperature = %v, want %v", *req.Options.Temperature, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package rag
+
+import (
+	"context"
+	"errors"
+
+	oAI "github.com/jcserv/portfolio-api/internal/api/openai"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	DefaultOpenAIChatModel      = openai.GPT3Dot5Turbo
+	DefaultOpenAIEmbeddingModel = string(openai.SmallEmbedding3)
+)
+
+// OpenAIProvider serves embeddings and chat from the OpenAI API, or any API
+// compatible with it.
+type OpenAIProvider struct {
+	client         *oAI.Client
+	chatModel      string
+	embeddingModel string
+}
+
+func NewOpenAIProvider(client *oAI.Client, chatModel, embeddingModel string) *OpenAIProvider {
+	return &OpenAIProvider{
+		client:         client,
+		chatModel:      chatModel,
+		embeddingModel: embeddingModel,
+	}
+}
+
+func (p *OpenAIProvider) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	resp, err := p.client.CreateEmbedding(ctx, openai.EmbeddingRequest{
+		Model: openai.EmbeddingModel(p.embeddingModel),
+		Input: []string{text},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, errors.New("openai returned no embeddings")
+	}
+	return resp.Data[0].Embedding, nil
+}
+
+func (p *OpenAIProvider) EmbeddingModel() string {
+	return p.embeddingModel
+}
+
+func (p *OpenAIProvider) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if request.Model == "" {
+		request.Model = p.chatModel
+	}
+	return p.client.CreateChatCompletion(ctx, request)
+}
+
+func (p *OpenAIProvider) CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (ChatStream, error) {
+	if request.Model == "" {
+		request.Model = p.chatModel
+	}
+	stream, err := p.client.CreateChatCompletionStream(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (p *OpenAIProvider) Capabilities() ChatCapabilities {
+	return ChatCapabilities{Tools: true, Generative: true}
+}
+
+func (p *OpenAIProvider) Moderate(ctx context.Context, text string) (bool, error) {
+	resp, err := p.client.CreateModeration(ctx, openai.ModerationRequest{Input: text})
+	if err != nil {
+		return false, err
+	}
+	for _, result := range resp.Results {
+		if result.Flagged {
+			return true, nil
+		}
+	}
+	return false, nil
+}
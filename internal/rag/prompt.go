@@ -0,0 +1,127 @@
+package rag
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+)
+
+//go:embed prompts/*.tmpl
+var promptFS embed.FS
+
+// DefaultPromptTemplate is the embedded template used when no template file
+// is configured.
+const DefaultPromptTemplate = "prompts/answer-v1.tmpl"
+
+// PromptTemplate renders the answer prompt. A template file defines three
+// named templates: "version", an identifier logged with every answer, and
+// "system" and "user", the messages sent to the chat model.
+type PromptTemplate struct {
+	version string
+	tmpl    *template.Template
+}
+
+// PromptData is the data available to prompt templates.
+type PromptData struct {
+	OwnerName string
+	Date      string
+	Documents []model.SearchResult
+	Question  string
+	// Delimiter must precede the question in the user prompt, marking where
+	// untrusted input begins
+	Delimiter string
+}
+
+// LoadPromptTemplate parses and validates the template at path, or the
+// embedded default template if path is empty.
+func LoadPromptTemplate(path string) (*PromptTemplate, error) {
+	var content []byte
+	var err error
+	if path == "" {
+		content, err = promptFS.ReadFile(DefaultPromptTemplate)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading prompt template: %w", err)
+	}
+
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("parsing prompt template: %w", err)
+	}
+
+	for _, name := range []string{"version", "system", "user"} {
+		if tmpl.Lookup(name) == nil {
+			return nil, fmt.Errorf("prompt template does not define %q", name)
+		}
+	}
+
+	var version strings.Builder
+	if err := tmpl.ExecuteTemplate(&version, "version", nil); err != nil {
+		return nil, fmt.Errorf("rendering prompt template version: %w", err)
+	}
+
+	t := &PromptTemplate{
+		version: strings.TrimSpace(version.String()),
+		tmpl:    tmpl,
+	}
+	if t.version == "" {
+		return nil, fmt.Errorf("prompt template version is empty")
+	}
+	if err := t.validate(); err != nil {
+		return nil, fmt.Errorf("validating prompt template %s: %w", t.version, err)
+	}
+	return t, nil
+}
+
+func (t *PromptTemplate) Version() string {
+	return t.version
+}
+
+// Render returns the system and user prompts for data.
+func (t *PromptTemplate) Render(data PromptData) (string, string, error) {
+	var system, user strings.Builder
+	if err := t.tmpl.ExecuteTemplate(&system, "system", data); err != nil {
+		return "", "", fmt.Errorf("rendering system prompt: %w", err)
+	}
+	if err := t.tmpl.ExecuteTemplate(&user, "user", data); err != nil {
+		return "", "", fmt.Errorf("rendering user prompt: %w", err)
+	}
+	return strings.TrimSpace(system.String()), strings.TrimSpace(user.String()), nil
+}
+
+// validate renders the template with sample data, checking that it only uses
+// known variables and places the question after the delimiter.
+func (t *PromptTemplate) validate() error {
+	sample := PromptData{
+		OwnerName: "owner",
+		Date:      formatPromptDate(time.Now()),
+		Documents: []model.SearchResult{{Title: "title", Category: model.CategoryProject, Text: "document"}},
+		Question:  "sample question",
+		Delimiter: questionDelimiter,
+	}
+
+	_, user, err := t.Render(sample)
+	if err != nil {
+		return err
+	}
+
+	i := strings.LastIndex(user, sample.Delimiter)
+	if i < 0 {
+		return fmt.Errorf("user prompt must contain {{ .Delimiter }}")
+	}
+	if !strings.Contains(user[i:], sample.Question) {
+		return fmt.Errorf("user prompt must contain {{ .Question }} after {{ .Delimiter }}")
+	}
+	return nil
+}
+
+func formatPromptDate(t time.Time) string {
+	return t.Format("January 2, 2006")
+}
@@ -0,0 +1,67 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	ProviderOpenAI = "openai"
+	ProviderOllama = "ollama"
+	ProviderLocal  = "local"
+)
+
+// EmbeddingProvider turns text into vectors for indexing and retrieval.
+type EmbeddingProvider interface {
+	GetEmbedding(ctx context.Context, text string) ([]float32, error)
+	// EmbeddingModel identifies the vector space, so embeddings from a
+	// different model are not compared against each other.
+	EmbeddingModel() string
+}
+
+// ChatProvider generates completions. Requests and responses use the OpenAI
+// chat shapes regardless of backend; an empty request model means the
+// provider's default.
+type ChatProvider interface {
+	CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+	CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (ChatStream, error)
+	// Capabilities reports what the provider's model can do
+	Capabilities() ChatCapabilities
+}
+
+// ChatCapabilities describes what a chat provider's model can do, so features
+// that need a capability are skipped for providers without it.
+type ChatCapabilities struct {
+	// Tools is set if the model can call tools
+	Tools bool
+	// Generative is set if the model writes text following instructions, so
+	// it can do tasks such as writing suggested questions
+	Generative bool
+}
+
+// ChatStream yields completion chunks until it returns io.EOF.
+type ChatStream interface {
+	Recv() (openai.ChatCompletionStreamResponse, error)
+	Close() error
+}
+
+// errNoChoices is returned for completions without any choices, which some
+// OpenAI-compatible servers send instead of an error.
+var errNoChoices = errors.New("chat completion returned no choices")
+
+// firstMessage returns the message of a completion's first choice.
+func firstMessage(completion openai.ChatCompletionResponse) (openai.ChatCompletionMessage, error) {
+	if len(completion.Choices) == 0 {
+		return openai.ChatCompletionMessage{}, errNoChoices
+	}
+	return completion.Choices[0].Message, nil
+}
+
+// zeroTemperature stands in for a temperature of 0 in completion requests.
+// go-openai omits a zero temperature, which the OpenAI API then treats as 1,
+// so the smallest nonzero value is sent instead. Providers with their own
+// clients send it as 0.
+const zeroTemperature = math.SmallestNonzeroFloat32
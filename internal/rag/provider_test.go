@@ -0,0 +1,37 @@
+package rag
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestFirstMessage(t *testing.T) {
+	tests := []struct {
+		name       string
+		completion openai.ChatCompletionResponse
+		want       string
+		wantErr    error
+	}{
+		{"no choices", openai.ChatCompletionResponse{}, "", errNoChoices},
+		{"one choice", openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{
+			{Message: openai.ChatCompletionMessage{Content: "first"}},
+		}}, "first", nil},
+		{"several choices", openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{
+			{Message: openai.ChatCompletionMessage{Content: "first"}},
+			{Message: openai.ChatCompletionMessage{Content: "second"}},
+		}}, "first", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := firstMessage(tt.completion)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("firstMessage() error = %v, want %v", err, tt.wantErr)
+			}
+			if got.Content != tt.want {
+				t.Errorf("firstMessage() = %q, want %q", got.Content, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jcserv/portfolio-api/internal/utils/log"
+	"github.com/pkg/errors"
+	"github.com/sashabaranov/go-openai"
+)
+
+const queryRewritePrompt = `You rewrite questions about a developer's portfolio into search queries.
+Expand vague or very short questions into a full question, spelling out abbreviations
+and naming the likely topics (e.g. "Go?" becomes "What experience and projects use the Go programming language?").
+Only return the rewritten query.`
+
+const hydePrompt = `Write a short passage, in the style of a resume bullet point or project description,
+that would answer the question about a developer's portfolio. It is fine to guess specifics.
+Only return the passage.`
+
+const queryExpansionPrompt = `Generate %d alternative search queries for the question about a developer's
+portfolio, each phrased differently or focusing on a different aspect of the question.
+Respond with JSON only, in the form {"queries": ["..."]}.`
+
+// searchQuery is one way of searching for a question. text is matched
+// lexically and embedding is matched against chunk vectors; they differ when
+// the embedding is of a hypothetical answer.
+type searchQuery struct {
+	text      string
+	embedding []float32
+}
+
+// transformQuery turns a question into the queries used for retrieval,
+// applying whichever of rewriting, HyDE and multi-query expansion are enabled.
+// Failed transformations are logged and skipped. questionEmbedding is
+// optional and reused if the question is embedded unchanged.
+func (s *Service) transformQuery(ctx context.Context, question string, questionEmbedding []float32) ([]searchQuery, error) {
+	base := question
+	if s.cfg.QueryRewrite {
+		rewritten, err := s.complete(ctx, queryRewritePrompt, question)
+		if err != nil {
+			log.Error(ctx, fmt.Sprintf("unable to rewrite query: %v", err))
+		} else if rewritten != "" {
+			log.Info(ctx, fmt.Sprintf("rewrote query: %s as: %s", question, rewritten))
+			base = rewritten
+		}
+	}
+
+	embedText := base
+	if s.cfg.QueryHyDE {
+		passage, err := s.complete(ctx, hydePrompt, base)
+		if err != nil {
+			log.Error(ctx, fmt.Sprintf("unable to generate hypothetical answer: %v", err))
+		} else if passage != "" {
+			log.Info(ctx, fmt.Sprintf("hypothetical answer for query: %s is: %s", base, passage))
+			embedText = passage
+		}
+	}
+
+	embedding := questionEmbedding
+	if embedding == nil || embedText != question {
+		var err error
+		embedding, err = s.embedder.GetEmbedding(ctx, embedText)
+		if err != nil {
+			return nil, err
+		}
+	}
+	queries := []searchQuery{{text: base, embedding: embedding}}
+
+	if s.cfg.QueryExpansions > 0 {
+		expansions, err := s.expandQuery(ctx, base, s.cfg.QueryExpansions)
+		if err != nil {
+			log.Error(ctx, fmt.Sprintf("unable to expand query: %v", err))
+		}
+		for _, text := range expansions {
+			embedding, err := s.embedder.GetEmbedding(ctx, text)
+			if err != nil {
+				return nil, err
+			}
+			queries = append(queries, searchQuery{text: text, embedding: embedding})
+		}
+	}
+
+	return queries, nil
+}
+
+func (s *Service) expandQuery(ctx context.Context, question string, n int) ([]string, error) {
+	completion, err := s.chat.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: fmt.Sprintf(queryExpansionPrompt, n),
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: question,
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	message, err := firstMessage(completion)
+	if err != nil {
+		return nil, err
+	}
+
+	var expansion struct {
+		Queries []string `json:"queries"`
+	}
+	if err := json.Unmarshal([]byte(message.Content), &expansion); err != nil {
+		return nil, errors.Wrap(err, "failed to parse expanded queries")
+	}
+
+	var queries []string
+	for _, q := range expansion.Queries {
+		q = strings.TrimSpace(q)
+		if q == "" || q == question {
+			continue
+		}
+		queries = append(queries, q)
+		if len(queries) == n {
+			break
+		}
+	}
+	log.Info(ctx, fmt.Sprintf("expanded query: %s into: %s", question, strings.Join(queries, " | ")))
+	return queries, nil
+}
+
+// complete runs a single-turn completion and returns the trimmed reply.
+func (s *Service) complete(ctx context.Context, instructions, input string) (string, error) {
+	completion, err := s.chat.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: instructions,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: input,
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	message, err := firstMessage(completion)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(message.Content), nil
+}
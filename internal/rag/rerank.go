@@ -0,0 +1,147 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/pkg/errors"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	RerankerNone    = "none"
+	RerankerLexical = "lexical"
+	RerankerLLM     = "llm"
+)
+
+// Reranker reorders retrieved documents by relevance to the query, setting
+// RerankScore on each. Higher scores are better.
+type Reranker interface {
+	Rerank(ctx context.Context, query string, docs []model.SearchResult) ([]model.SearchResult, error)
+}
+
+func NewReranker(name string, chat ChatProvider) (Reranker, error) {
+	switch name {
+	case RerankerNone, "":
+		return nil, nil
+	case RerankerLexical:
+		return NewLexicalReranker(), nil
+	case RerankerLLM:
+		return NewLLMReranker(chat), nil
+	}
+	return nil, fmt.Errorf("unknown reranker: %s", name)
+}
+
+// LexicalReranker scores documents by the fraction of query terms they
+// contain. It needs no network access.
+type LexicalReranker struct{}
+
+func NewLexicalReranker() *LexicalReranker {
+	return &LexicalReranker{}
+}
+
+func (r *LexicalReranker) Rerank(ctx context.Context, query string, docs []model.SearchResult) ([]model.SearchResult, error) {
+	queryTerms := termSet(query)
+
+	reranked := make([]model.SearchResult, len(docs))
+	copy(reranked, docs)
+	for i := range reranked {
+		var score float64
+		if len(queryTerms) > 0 {
+			docTerms := termSet(reranked[i].Text)
+			var overlap int
+			for t := range queryTerms {
+				if _, ok := docTerms[t]; ok {
+					overlap++
+				}
+			}
+			score = float64(overlap) / float64(len(queryTerms))
+		}
+		reranked[i].RerankScore = &score
+	}
+
+	sortByRerankScore(reranked)
+	return reranked, nil
+}
+
+const llmRerankPrompt = `You rate how relevant documents are to a question about a developer's portfolio.
+Rate every document from 0 (irrelevant) to 10 (directly answers the question).
+Respond with JSON only, in the form {"scores": [{"id": 1, "score": 7}]}, using the document ids given.`
+
+// LLMReranker asks the chat model to rate each document.
+type LLMReranker struct {
+	chat ChatProvider
+}
+
+func NewLLMReranker(chat ChatProvider) *LLMReranker {
+	return &LLMReranker{chat: chat}
+}
+
+func (r *LLMReranker) Rerank(ctx context.Context, query string, docs []model.SearchResult) ([]model.SearchResult, error) {
+	var prompt strings.Builder
+	for i, doc := range docs {
+		prompt.WriteString(fmt.Sprintf("Document %d:\n%s\n\n", i+1, doc.Text))
+	}
+	prompt.WriteString("Question: " + query)
+
+	completion, err := r.chat.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: llmRerankPrompt,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt.String(),
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	message, err := firstMessage(completion)
+	if err != nil {
+		return nil, err
+	}
+
+	var ratings struct {
+		Scores []struct {
+			ID    int     `json:"id"`
+			Score float64 `json:"score"`
+		} `json:"scores"`
+	}
+	if err := json.Unmarshal([]byte(message.Content), &ratings); err != nil {
+		return nil, errors.Wrap(err, "failed to parse rerank scores")
+	}
+
+	reranked := make([]model.SearchResult, len(docs))
+	copy(reranked, docs)
+	for i := range reranked {
+		score := 0.0
+		reranked[i].RerankScore = &score
+	}
+	for _, rating := range ratings.Scores {
+		if rating.ID < 1 || rating.ID > len(reranked) {
+			continue
+		}
+		score := rating.Score / 10
+		reranked[rating.ID-1].RerankScore = &score
+	}
+
+	sortByRerankScore(reranked)
+	return reranked, nil
+}
+
+// sortByRerankScore sorts by rerank score, keeping retrieval order for ties.
+func sortByRerankScore(docs []model.SearchResult) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		return *docs[i].RerankScore > *docs[j].RerankScore
+	})
+}
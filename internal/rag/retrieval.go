@@ -0,0 +1,271 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jcserv/portfolio-api/internal/db"
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/jcserv/portfolio-api/internal/utils/log"
+	"github.com/jcserv/portfolio-api/internal/utils/tokenizer"
+)
+
+const (
+	RetrievalModeVector = "vector"
+	RetrievalModeHybrid = "hybrid"
+)
+
+// minCandidates is the smallest number of results fetched from each ranking
+// before they are fused.
+const minCandidates = 20
+
+// chunksPerDocument is how many chunks are retrieved for each document
+// requested, since several of the best chunks often share a parent.
+const chunksPerDocument = 4
+
+// retrieveAndRerank returns the limit documents matching filter that are most
+// relevant to queries. With a reranker configured, more candidates are
+// retrieved and the reranker picks the ones that best match question.
+func (s *Service) retrieveAndRerank(ctx context.Context, question string, queries []searchQuery, limit int, filter model.SearchFilter) ([]model.SearchResult, error) {
+	if s.reranker == nil {
+		return s.retrieve(ctx, queries, limit, filter)
+	}
+
+	candidates := s.cfg.RerankCandidates
+	if candidates < limit {
+		candidates = limit
+	}
+	docs, err := s.retrieve(ctx, queries, candidates, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	reranked, err := s.reranker.Rerank(ctx, question, docs)
+	if err != nil {
+		log.Error(ctx, fmt.Sprintf("unable to rerank documents, using retrieval order: %v", err))
+		reranked = docs
+	}
+
+	if len(reranked) > limit {
+		reranked = reranked[:limit]
+	}
+	for _, doc := range reranked {
+		if doc.RerankScore != nil {
+			log.Info(ctx, fmt.Sprintf("reranked document %d (%s) score: %.3f, retrieval score: %.4f", doc.ID, doc.Title, *doc.RerankScore, doc.Score))
+		}
+	}
+	return reranked, nil
+}
+
+// retrieve returns the limit documents matching filter that are most relevant
+// to queries. Chunks are scored, and each document takes the score of its best
+// chunk. The chunk rankings of multiple queries are merged with reciprocal
+// rank fusion.
+func (s *Service) retrieve(ctx context.Context, queries []searchQuery, limit int, filter model.SearchFilter) ([]model.SearchResult, error) {
+	chunkLimit := limit * chunksPerDocument
+
+	rankings := make([]weightedRanking, 0, len(queries))
+	for _, q := range queries {
+		chunks, err := s.retrieveChunks(ctx, q.text, q.embedding, chunkLimit, filter)
+		if err != nil {
+			return nil, err
+		}
+		rankings = append(rankings, weightedRanking{results: chunks, weight: 1, similarity: true})
+	}
+
+	var chunks []model.SearchResult
+	if len(rankings) == 1 {
+		chunks = rankings[0].results
+	} else {
+		chunks = fuseRankings(chunkLimit, s.cfg.RRFK, rankings...)
+	}
+	return s.parentDocuments(ctx, chunks, limit)
+}
+
+// retrieveChunks returns the limit chunks of documents matching filter that
+// are most relevant to query. In hybrid mode the vector and BM25 rankings are
+// combined with reciprocal rank fusion, and the returned scores are cosine
+// similarities, zero for chunks only matched by BM25. Chunks below the minimum similarity are dropped, and nothing is
+// returned if no chunk reaches it.
+func (s *Service) retrieveChunks(ctx context.Context, query string, queryEmbedding []float32, limit int, filter model.SearchFilter) ([]model.SearchResult, error) {
+	if s.cfg.RetrievalMode != RetrievalModeHybrid {
+		vector, err := s.db.FindSimilar(ctx, queryEmbedding, limit, filter, s.mmr())
+		if err != nil {
+			return nil, err
+		}
+		return s.aboveMinSimilarity(vector), nil
+	}
+
+	candidates := limit * 4
+	if candidates < minCandidates {
+		candidates = minCandidates
+	}
+
+	vector, err := s.db.FindSimilar(ctx, queryEmbedding, candidates, filter, s.mmr())
+	if err != nil {
+		return nil, err
+	}
+
+	// Lexical matches alone are not enough to treat a question as in scope
+	vector = s.aboveMinSimilarity(vector)
+	if len(vector) == 0 {
+		return nil, nil
+	}
+
+	lexical, err := s.db.FindLexical(ctx, query, candidates, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return fuseRankings(limit, s.cfg.RRFK,
+		weightedRanking{results: vector, weight: 1 - s.cfg.LexicalWeight, similarity: true},
+		weightedRanking{results: lexical, weight: s.cfg.LexicalWeight},
+	), nil
+}
+
+// mmr returns the MMR selection for vector search, or nil to rank by
+// similarity alone.
+func (s *Service) mmr() *db.MMR {
+	if !s.cfg.MMR {
+		return nil
+	}
+	return &db.MMR{Lambda: s.cfg.MMRLambda}
+}
+
+// aboveMinSimilarity returns the results whose similarity is at least the
+// configured minimum, in order. MMR results are not sorted by similarity, so
+// every result is checked.
+func (s *Service) aboveMinSimilarity(results []model.SearchResult) []model.SearchResult {
+	kept := make([]model.SearchResult, 0, len(results))
+	for _, r := range results {
+		if r.Score >= s.cfg.MinSimilarity {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+type weightedRanking struct {
+	results []model.SearchResult
+	weight  float64
+	// similarity is set if the results are scored by cosine similarity,
+	// which fused results keep as their score
+	similarity bool
+}
+
+// fuseRankings merges rankings with weighted reciprocal rank fusion, ordering
+// results by sum(weight / (k + rank(d))) over every ranking containing d. The
+// fused value is only used for ordering: each result keeps its highest score
+// from the rankings scored by similarity, or zero if it is in none of them.
+func fuseRankings(limit, k int, rankings ...weightedRanking) []model.SearchResult {
+	type fusedResult struct {
+		result model.SearchResult
+		rrf    float64
+	}
+
+	fused := make(map[int64]*fusedResult)
+	for _, ranking := range rankings {
+		for i, r := range ranking.results {
+			f, ok := fused[r.ID]
+			if !ok {
+				f = &fusedResult{result: r}
+				f.result.Score = 0
+				fused[r.ID] = f
+			}
+			f.rrf += ranking.weight / float64(k+i+1)
+			if ranking.similarity && r.Score > f.result.Score {
+				f.result.Score = r.Score
+			}
+		}
+	}
+
+	ordered := make([]*fusedResult, 0, len(fused))
+	for _, f := range fused {
+		ordered = append(ordered, f)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].rrf == ordered[j].rrf {
+			return ordered[i].result.ID < ordered[j].result.ID
+		}
+		return ordered[i].rrf > ordered[j].rrf
+	})
+
+	if len(ordered) > limit {
+		ordered = ordered[:limit]
+	}
+	results := make([]model.SearchResult, 0, len(ordered))
+	for _, f := range ordered {
+		results = append(results, f.result)
+	}
+	return results
+}
+
+// parentDocuments replaces ranked chunks with their deduplicated parent
+// documents, keeping the order of each parent's best chunk.
+func (s *Service) parentDocuments(ctx context.Context, chunks []model.SearchResult, limit int) ([]model.SearchResult, error) {
+	var ids []int64
+	scores := make(map[int64]float64)
+	for _, c := range chunks {
+		if _, ok := scores[c.ParentID]; ok {
+			continue
+		}
+		scores[c.ParentID] = c.Score
+		ids = append(ids, c.ParentID)
+		if len(ids) == limit {
+			break
+		}
+	}
+
+	docs, err := s.db.GetDocuments(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]model.SearchResult, 0, len(ids))
+	for _, id := range ids {
+		doc, ok := docs[id]
+		if !ok {
+			continue
+		}
+		results = append(results, model.SearchResult{
+			ID:       doc.ID,
+			Category: doc.Category,
+			Title:    doc.Title,
+			Text:     doc.Text,
+			Score:    scores[id],
+		})
+	}
+	return results, nil
+}
+
+// packContext sends the topK most relevant documents, then as many of the
+// rest as fit in the context token budget, in order of relevance. Documents
+// too long for the remaining budget are skipped in favour of shorter, less
+// relevant ones.
+func (s *Service) packContext(ctx context.Context, docs []model.SearchResult, topK int, chatModel string) []model.SearchResult {
+	budget := s.cfg.ContextTokenBudget
+	if budget <= 0 || len(docs) <= topK {
+		return docs
+	}
+
+	t, err := tokenizer.ForModel(chatModel)
+	if err != nil {
+		log.Error(ctx, fmt.Sprintf("unable to load tokenizer, skipping context packing: %v", err))
+		return docs[:topK]
+	}
+
+	used := 0
+	packed := make([]model.SearchResult, 0, len(docs))
+	for i, doc := range docs {
+		tokens := t.Count(doc.Text)
+		if i >= topK && used+tokens > budget {
+			continue
+		}
+		used += tokens
+		packed = append(packed, doc)
+	}
+
+	log.Info(ctx, fmt.Sprintf("packed %d of %d documents into %d of %d context tokens (%s)", len(packed), len(docs), used, budget, t.Encoding()))
+	return packed
+}
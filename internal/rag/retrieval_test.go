@@ -0,0 +1,75 @@
+package rag
+
+import (
+	"testing"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+)
+
+// ranking returns a ranking of the results with ids, in order.
+func ranking(weight float64, ids ...int64) weightedRanking {
+	results := make([]model.SearchResult, 0, len(ids))
+	for _, id := range ids {
+		results = append(results, model.SearchResult{ID: id})
+	}
+	return weightedRanking{results: results, weight: weight}
+}
+
+func TestFuseRankings(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		rankings []weightedRanking
+		want     []int64
+	}{
+		{"no rankings", 10, nil, []int64{}},
+		{"one ranking keeps its order", 10, []weightedRanking{ranking(1, 3, 1, 2)}, []int64{3, 1, 2}},
+		{"results in both rankings come first", 10, []weightedRanking{ranking(1, 1, 2), ranking(1, 2, 3)}, []int64{2, 1, 3}},
+		{"heavier ranking wins", 10, []weightedRanking{ranking(0.3, 1, 2), ranking(0.7, 2, 1)}, []int64{2, 1}},
+		{"ties are broken by id", 10, []weightedRanking{ranking(1, 2), ranking(1, 1)}, []int64{1, 2}},
+		{"limit", 2, []weightedRanking{ranking(1, 1, 2, 3, 4)}, []int64{1, 2}},
+		{"zero weight still includes results", 10, []weightedRanking{ranking(1, 1), ranking(0, 2)}, []int64{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fuseRankings(tt.limit, 60, tt.rankings...)
+			ids := make([]int64, 0, len(got))
+			for _, r := range got {
+				ids = append(ids, r.ID)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("fuseRankings() = %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Fatalf("fuseRankings() = %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFuseRankingsScores(t *testing.T) {
+	vector := weightedRanking{
+		results:    []model.SearchResult{{ID: 1, Score: 0.8}, {ID: 2, Score: 0.6}},
+		weight:     0.7,
+		similarity: true,
+	}
+	expanded := weightedRanking{
+		results:    []model.SearchResult{{ID: 2, Score: 0.9}},
+		weight:     0.7,
+		similarity: true,
+	}
+	lexical := weightedRanking{
+		results: []model.SearchResult{{ID: 3, Score: 12.5}, {ID: 1, Score: 4.2}},
+		weight:  0.3,
+	}
+
+	// Results keep their best similarity, and BM25 scores are dropped
+	want := map[int64]float64{1: 0.8, 2: 0.9, 3: 0}
+	for _, r := range fuseRankings(10, 60, vector, expanded, lexical) {
+		if r.Score != want[r.ID] {
+			t.Errorf("score of %d = %v, want %v", r.ID, r.Score, want[r.ID])
+		}
+	}
+}
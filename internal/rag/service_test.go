@@ -0,0 +1,88 @@
+package rag
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jcserv/portfolio-api/internal/db"
+	"github.com/jcserv/portfolio-api/internal/model"
+)
+
+// toolChat is the local provider, reporting that it can call tools.
+type toolChat struct {
+	*LocalProvider
+}
+
+func (toolChat) Capabilities() ChatCapabilities {
+	return ChatCapabilities{Tools: true}
+}
+
+// newTestService returns a service over a small indexed corpus, using the
+// local provider for embeddings.
+func newTestService(t *testing.T, chat ChatProvider, cfg Config) *Service {
+	t.Helper()
+	ctx := context.Background()
+
+	database, err := db.NewLibSQL(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewLibSQL() error = %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	prompt, err := LoadPromptTemplate("")
+	if err != nil {
+		t.Fatalf("LoadPromptTemplate() error = %v", err)
+	}
+	cfg.Prompt = prompt
+	cfg.OutOfScopeResponse = "Sorry, I can only answer questions about the portfolio."
+	cfg.TopK, cfg.MaxTopK = 3, 10
+
+	s := NewService(database, NewLocalProvider(), chat, nil, nil, cfg)
+	experiences := []model.Experience{
+		{Workplace: "SailPoint", Position: "Software Engineer Intern", Tech: []string{"Go", "Kafka"}, Description: []string{"Built event pipelines with Kafka."}},
+	}
+	projects := []model.Project{
+		{Name: "ResumeWords", Description: "Scores resumes against job postings.", Tech: []string{"React"}},
+	}
+	if _, err := s.IndexCorpus(ctx, experiences, projects); err != nil {
+		t.Fatalf("IndexCorpus() error = %v", err)
+	}
+	return s
+}
+
+func TestAnswerOutOfScope(t *testing.T) {
+	tests := []struct {
+		name        string
+		chat        ChatProvider
+		toolCalling bool
+		question    string
+		want        bool
+	}{
+		{"off-topic", toolChat{NewLocalProvider()}, true, "What's the weather like today?", true},
+		{"count with tools", toolChat{NewLocalProvider()}, true, "How many internships has he done?", false},
+		{"workplace with tools", toolChat{NewLocalProvider()}, true, "Tell me about SailPoint", false},
+		{"count without tool calling", toolChat{NewLocalProvider()}, false, "How many internships has he done?", true},
+		{"count with the local provider", NewLocalProvider(), true, "How many internships has he done?", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// No document is similar enough to any question
+			s := newTestService(t, tt.chat, Config{MinSimilarity: 1, ToolCalling: tt.toolCalling, MaxToolIterations: 1})
+
+			resp, err := s.Answer(context.Background(), Request{Question: tt.question})
+			if err != nil {
+				t.Fatalf("Answer() error = %v", err)
+			}
+			if len(resp.Sources) != 0 {
+				t.Fatalf("Answer() sources = %v, want none", resp.Sources)
+			}
+			if resp.OutOfScope != tt.want {
+				t.Errorf("Answer(%q) out of scope = %v, want %v", tt.question, resp.OutOfScope, tt.want)
+			}
+			if tt.want && resp.Answer != s.cfg.OutOfScopeResponse {
+				t.Errorf("Answer(%q) = %q, want the out of scope response", tt.question, resp.Answer)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/jcserv/portfolio-api/internal/utils/log"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	minFollowUpQuestions = 2
+	maxFollowUpQuestions = 3
+)
+
+const structuredAnswerPrompt = `Respond with JSON only, in the form
+{"answer": "...", "follow_up_questions": ["..."], "entities": ["..."]}, where:
+ - answer is the answer to the question, formatted as markdown
+ - follow_up_questions are 2 or 3 short questions the user could ask next, which the provided information can answer
+ - entities are the names of the employers and projects from the provided information that the answer mentions`
+
+const structuredAnswerRetryPrompt = `That response was invalid: %v.
+Respond again with JSON only, in the required form.`
+
+// generatedAnswer is an answer from the chat model, before guardrails are
+// applied.
+type generatedAnswer struct {
+	Text              string
+	FollowUpQuestions []string
+	Entities          []model.Entity
+}
+
+// generate answers a pending question. With structured answers enabled, the
+// chat model is asked for JSON and retried if its output is malformed; if
+// every attempt is malformed, the answer is salvaged without follow-up
+// questions or entities.
+func (s *Service) generate(ctx context.Context, p *pendingAnswer) (generatedAnswer, error) {
+	request := s.chatRequest(p)
+	// Tool calls and retries append to the conversation, which must not
+	// change p.messages
+	request.Messages = append([]openai.ChatCompletionMessage{}, request.Messages...)
+
+	if !s.cfg.StructuredAnswers {
+		content, err := s.completeWithTools(ctx, &request)
+		if err != nil {
+			return generatedAnswer{}, err
+		}
+		return generatedAnswer{Text: content}, nil
+	}
+
+	var content string
+	attempts := s.cfg.StructuredAnswerRetries + 1
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var err error
+		content, err = s.completeWithTools(ctx, &request)
+		if err != nil {
+			return generatedAnswer{}, err
+		}
+
+		answer, err := parseStructuredAnswer(content, p.sources)
+		if err == nil {
+			return answer, nil
+		}
+		log.Error(ctx, fmt.Sprintf("malformed structured answer (attempt %d of %d): %v, %d characters", attempt, attempts, err, len(content)))
+
+		request.Messages = append(request.Messages,
+			openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: content,
+			},
+			openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleUser,
+				Content: fmt.Sprintf(structuredAnswerRetryPrompt, err),
+			},
+		)
+	}
+	return generatedAnswer{Text: salvageAnswer(content, "")}, nil
+}
+
+// streamedAnswer parses a streamed completion.
+func (s *Service) streamedAnswer(ctx context.Context, p *pendingAnswer, d *answerFieldDecoder) generatedAnswer {
+	if !s.cfg.StructuredAnswers {
+		return generatedAnswer{Text: d.Raw()}
+	}
+
+	answer, err := parseStructuredAnswer(d.Raw(), p.sources)
+	if err != nil {
+		log.Error(ctx, fmt.Sprintf("malformed structured answer: %v, %d characters", err, len(d.Raw())))
+		return generatedAnswer{Text: salvageAnswer(d.Raw(), d.Text())}
+	}
+	return answer
+}
+
+type structuredAnswer struct {
+	Answer            string   `json:"answer"`
+	FollowUpQuestions []string `json:"follow_up_questions"`
+	Entities          []string `json:"entities"`
+}
+
+// parseStructuredAnswer validates a structured answer from the chat model.
+// Entities are only kept if they name one of the sources, and sources named
+// in the answer are added even if the model left them out.
+func parseStructuredAnswer(content string, sources []model.SearchResult) (generatedAnswer, error) {
+	var raw structuredAnswer
+	if err := json.Unmarshal([]byte(trimCodeFence(content)), &raw); err != nil {
+		return generatedAnswer{}, fmt.Errorf("response is not valid JSON: %w", err)
+	}
+
+	answer := generatedAnswer{Text: strings.TrimSpace(raw.Answer)}
+	if answer.Text == "" {
+		return generatedAnswer{}, fmt.Errorf("answer is empty")
+	}
+
+	seen := make(map[string]struct{})
+	for _, q := range raw.FollowUpQuestions {
+		q = strings.TrimSpace(q)
+		if _, ok := seen[strings.ToLower(q)]; ok || q == "" {
+			continue
+		}
+		seen[strings.ToLower(q)] = struct{}{}
+		answer.FollowUpQuestions = append(answer.FollowUpQuestions, q)
+	}
+	if len(answer.FollowUpQuestions) < minFollowUpQuestions {
+		return generatedAnswer{}, fmt.Errorf("expected %d to %d follow_up_questions, got %d",
+			minFollowUpQuestions, maxFollowUpQuestions, len(answer.FollowUpQuestions))
+	}
+	if len(answer.FollowUpQuestions) > maxFollowUpQuestions {
+		answer.FollowUpQuestions = answer.FollowUpQuestions[:maxFollowUpQuestions]
+	}
+
+	answer.Entities = sourceEntities(answer.Text, raw.Entities, sources)
+	return answer, nil
+}
+
+// sourceEntities returns the sources named in names or mentioned in text.
+func sourceEntities(text string, names []string, sources []model.SearchResult) []model.Entity {
+	named := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		named[strings.ToLower(strings.TrimSpace(name))] = struct{}{}
+	}
+	lowerText := strings.ToLower(text)
+
+	entities := []model.Entity{}
+	seen := make(map[string]struct{})
+	for _, source := range sources {
+		title := strings.ToLower(source.Title)
+		if _, ok := seen[title]; ok || title == "" {
+			continue
+		}
+		if _, ok := named[title]; !ok && !strings.Contains(lowerText, title) {
+			continue
+		}
+		seen[title] = struct{}{}
+
+		entityType := model.EntityProject
+		if source.Category == model.CategoryExperience {
+			entityType = model.EntityEmployer
+		}
+		entities = append(entities, model.Entity{Name: source.Title, Type: entityType})
+	}
+	return entities
+}
+
+// salvageAnswer returns the answer from malformed structured output: the
+// answer field if the output is JSON with one, otherwise streamed if any of
+// the answer was streamed, otherwise the whole output.
+func salvageAnswer(content, streamed string) string {
+	var raw structuredAnswer
+	if err := json.Unmarshal([]byte(trimCodeFence(content)), &raw); err == nil && strings.TrimSpace(raw.Answer) != "" {
+		return strings.TrimSpace(raw.Answer)
+	}
+	if streamed != "" {
+		return streamed
+	}
+	return strings.TrimSpace(content)
+}
+
+// trimCodeFence strips a markdown code fence that some models wrap JSON in.
+func trimCodeFence(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") {
+		return content
+	}
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+	return strings.TrimSpace(content)
+}
+
+var answerFieldRegex = regexp.MustCompile(`"answer"\s*:\s*"`)
+
+// answerFieldDecoder extracts the answer field of a structured answer as it
+// streams in, so the answer can be forwarded before the JSON is complete.
+// With passthrough set, the completion is the answer and is not decoded.
+type answerFieldDecoder struct {
+	passthrough bool
+
+	raw  strings.Builder
+	text strings.Builder
+	// pos is how far into raw the answer has been decoded, zero until the
+	// answer field is found
+	pos  int
+	done bool
+}
+
+// Write adds a chunk of the structured answer, returning the text of the
+// answer field decoded from it.
+func (d *answerFieldDecoder) Write(chunk string) string {
+	d.raw.WriteString(chunk)
+	if d.passthrough {
+		d.text.WriteString(chunk)
+		return chunk
+	}
+	if d.done {
+		return ""
+	}
+
+	raw := d.raw.String()
+	if d.pos == 0 {
+		loc := answerFieldRegex.FindStringIndex(raw)
+		if loc == nil {
+			return ""
+		}
+		d.pos = loc[1]
+	}
+
+	var decoded strings.Builder
+decode:
+	for d.pos < len(raw) {
+		switch raw[d.pos] {
+		case '"':
+			d.done = true
+			break decode
+		case '\\':
+			n := escapeLength(raw[d.pos:])
+			if n == 0 {
+				// Wait for the rest of the escape sequence
+				break decode
+			}
+			var s string
+			if err := json.Unmarshal([]byte(`"`+raw[d.pos:d.pos+n]+`"`), &s); err != nil {
+				d.done = true
+				break decode
+			}
+			decoded.WriteString(s)
+			d.pos += n
+		default:
+			end := d.pos + 1
+			for end < len(raw) && raw[end] != '"' && raw[end] != '\\' {
+				end++
+			}
+			decoded.WriteString(raw[d.pos:end])
+			d.pos = end
+		}
+	}
+
+	d.text.WriteString(decoded.String())
+	return decoded.String()
+}
+
+// Raw returns everything written so far.
+func (d *answerFieldDecoder) Raw() string {
+	return d.raw.String()
+}
+
+// Text returns the answer decoded so far.
+func (d *answerFieldDecoder) Text() string {
+	return d.text.String()
+}
+
+// escapeLength returns the length of the JSON escape sequence at the start of
+// s, or zero if s ends before the sequence does.
+func escapeLength(s string) int {
+	if len(s) < 2 {
+		return 0
+	}
+	if s[1] != 'u' {
+		return 2
+	}
+	if len(s) < 6 {
+		return 0
+	}
+	// A high surrogate is only decoded along with the low surrogate after it
+	if r, err := strconv.ParseUint(s[2:6], 16, 16); err == nil && r >= 0xD800 && r <= 0xDBFF {
+		if len(s) < 12 {
+			return 0
+		}
+		return 12
+	}
+	return 6
+}
@@ -0,0 +1,74 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnswerFieldDecoder(t *testing.T) {
+	tests := []struct {
+		name        string
+		passthrough bool
+		raw         string
+		want        string
+	}{
+		{"plain", false, `{"answer": "He worked at SailPoint.", "entities": []}`, "He worked at SailPoint."},
+		{"answer after other fields", false, `{"entities": ["Citi"], "answer":"At Citi."}`, "At Citi."},
+		{"escapes", false, `{"answer": "Line one\nLine \"two\"\\ \/ done"}`, "Line one\nLine \"two\"\\ / done"},
+		{"unicode escape", false, `{"answer": "caf\u00e9"}`, "café"},
+		{"surrogate pair", false, `{"answer": "ship it \ud83d\ude80!"}`, "ship it 🚀!"},
+		{"multibyte", false, `{"answer": "héllo wörld 🚀"}`, "héllo wörld 🚀"},
+		{"unterminated", false, `{"answer": "cut off`, "cut off"},
+		{"no answer field", false, `{"entities": []}`, ""},
+		{"passthrough", true, `He said "hi"\n`, `He said "hi"\n`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The whole completion, every way of splitting it in two, and one
+			// rune at a time. Streamed deltas are always whole runes
+			splits := [][]string{{tt.raw}}
+			for i := range tt.raw {
+				splits = append(splits, []string{tt.raw[:i], tt.raw[i:]})
+			}
+			splits = append(splits, strings.SplitAfter(tt.raw, ""))
+
+			for _, chunks := range splits {
+				d := &answerFieldDecoder{passthrough: tt.passthrough}
+				var got strings.Builder
+				for _, chunk := range chunks {
+					got.WriteString(d.Write(chunk))
+				}
+				if got.String() != tt.want {
+					t.Fatalf("decoded %q from chunks %q, want %q", got.String(), chunks, tt.want)
+				}
+				if d.Text() != tt.want {
+					t.Fatalf("Text() = %q from chunks %q, want %q", d.Text(), chunks, tt.want)
+				}
+				if d.Raw() != tt.raw {
+					t.Fatalf("Raw() = %q, want %q", d.Raw(), tt.raw)
+				}
+			}
+		})
+	}
+}
+
+func TestEscapeLength(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{`\`, 0},
+		{`\n`, 2},
+		{`\"rest`, 2},
+		{`\u00`, 0},
+		{`\u00e9`, 6},
+		{`\ud83d`, 0},
+		{`\ud83d\ude`, 0},
+		{`\ud83d\ude80`, 12},
+	}
+	for _, tt := range tests {
+		if got := escapeLength(tt.s); got != tt.want {
+			t.Errorf("escapeLength(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/jcserv/portfolio-api/internal/utils"
+	"github.com/jcserv/portfolio-api/internal/utils/log"
+	"github.com/pkg/errors"
+	"github.com/sashabaranov/go-openai"
+)
+
+// suggestionExcerptLength is how many characters of each document are shown to the chat
+// model when generating suggestions.
+const suggestionExcerptLength = 300
+
+const suggestionsPrompt = `You write starter questions for a chatbot that answers questions about %s's
+professional experience and projects, based on the documents given.
+Write %d short, varied questions a recruiter or visitor would want to ask, each answerable from the documents.
+Respond with JSON only, in the form {"questions": ["..."]}.`
+
+// UpdateSuggestions generates starter questions from the indexed documents.
+// They are only regenerated when the content of the corpus, the number of
+// suggestions or the owner's name changes.
+func (s *Service) UpdateSuggestions(ctx context.Context) error {
+	contentHash, err := s.db.ComputeContentHash(ctx)
+	if err != nil {
+		return err
+	}
+	hash := utils.HashContent(fmt.Sprintf("%s\n%d\n%s", contentHash, s.cfg.SuggestionCount, s.cfg.OwnerName))
+	current, ok, err := s.db.GetSuggestionsContentHash(ctx)
+	if err != nil {
+		return err
+	}
+	if ok && current == hash {
+		return nil
+	}
+
+	docs, err := s.db.ListDocuments(ctx)
+	if err != nil {
+		return err
+	}
+
+	var questions []string
+	// Providers like the local one only quote their input, so templates are
+	// expected
+	if !s.chat.Capabilities().Generative {
+		log.Info(ctx, "chat provider can't write suggestions, using templates")
+	} else if questions, err = s.generateSuggestions(ctx, docs); err != nil {
+		log.Error(ctx, fmt.Sprintf("unable to generate suggestions, using templates: %v", err))
+	}
+	// Top up with template questions if the chat model wrote too few
+	questions = dedupeQuestions(append(questions, templateSuggestions(s.cfg.OwnerName, docs)...))
+	if len(questions) > s.cfg.SuggestionCount {
+		questions = questions[:s.cfg.SuggestionCount]
+	}
+
+	if err := s.db.ReplaceSuggestions(ctx, hash, questions); err != nil {
+		return err
+	}
+	log.Info(ctx, fmt.Sprintf("generated %d suggestions: %s", len(questions), strings.Join(questions, " | ")))
+	return nil
+}
+
+// Suggestions returns the curated starter questions followed by the
+// generated ones.
+func (s *Service) Suggestions(ctx context.Context) ([]model.Suggestion, error) {
+	generated, err := s.db.GetSuggestions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]model.Suggestion, 0, len(s.cfg.CuratedSuggestions)+len(generated))
+	curated := make(map[string]struct{}, len(s.cfg.CuratedSuggestions))
+	for _, q := range s.cfg.CuratedSuggestions {
+		curated[strings.ToLower(q)] = struct{}{}
+		suggestions = append(suggestions, model.Suggestion{Question: q, Source: model.SuggestionCurated})
+	}
+	for _, q := range generated {
+		if _, ok := curated[strings.ToLower(q)]; ok {
+			continue
+		}
+		suggestions = append(suggestions, model.Suggestion{Question: q, Source: model.SuggestionGenerated})
+	}
+	return suggestions, nil
+}
+
+func (s *Service) generateSuggestions(ctx context.Context, docs []model.Document) ([]string, error) {
+	var prompt strings.Builder
+	for _, doc := range docs {
+		excerpt := doc.Text
+		if runes := []rune(excerpt); len(runes) > suggestionExcerptLength {
+			excerpt = string(runes[:suggestionExcerptLength])
+		}
+		prompt.WriteString(fmt.Sprintf("%s (%s):\n%s\n\n", doc.Title, doc.Category, excerpt))
+	}
+
+	completion, err := s.chat.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: fmt.Sprintf(suggestionsPrompt, s.cfg.OwnerName, s.cfg.SuggestionCount),
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt.String(),
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	message, err := firstMessage(completion)
+	if err != nil {
+		return nil, err
+	}
+
+	var suggestions struct {
+		Questions []string `json:"questions"`
+	}
+	if err := json.Unmarshal([]byte(message.Content), &suggestions); err != nil {
+		return nil, errors.Wrap(err, "failed to parse suggestions")
+	}
+
+	var questions []string
+	for _, q := range suggestions.Questions {
+		q = strings.TrimSpace(q)
+		if strings.HasSuffix(q, "?") {
+			questions = append(questions, q)
+		}
+	}
+	return questions, nil
+}
+
+// templateSuggestions asks about each document in turn, alternating between
+// experience and projects.
+func templateSuggestions(ownerName string, docs []model.Document) []string {
+	var experience, projects []string
+	for _, doc := range docs {
+		switch doc.Category {
+		case model.CategoryExperience:
+			experience = append(experience, fmt.Sprintf("What did %s do at %s?", ownerName, doc.Title))
+		case model.CategoryProject:
+			projects = append(projects, fmt.Sprintf("What is %s?", doc.Title))
+		}
+	}
+
+	questions := make([]string, 0, len(experience)+len(projects))
+	for i := 0; i < len(experience) || i < len(projects); i++ {
+		if i < len(experience) {
+			questions = append(questions, experience[i])
+		}
+		if i < len(projects) {
+			questions = append(questions, projects[i])
+		}
+	}
+	return questions
+}
+
+func dedupeQuestions(questions []string) []string {
+	seen := make(map[string]struct{}, len(questions))
+	deduped := make([]string, 0, len(questions))
+	for _, q := range questions {
+		key := strings.ToLower(q)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		deduped = append(deduped, q)
+	}
+	return deduped
+}
@@ -0,0 +1,40 @@
+package rag
+
+import (
+	"regexp"
+	"strings"
+)
+
+var wordRegex = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+var stopwords = map[string]struct{}{
+	"a": {}, "about": {}, "an": {}, "and": {}, "any": {}, "are": {}, "as": {}, "at": {},
+	"be": {}, "by": {}, "can": {}, "did": {}, "do": {}, "does": {}, "for": {}, "from": {},
+	"has": {}, "have": {}, "he": {}, "his": {}, "how": {}, "i": {}, "in": {}, "is": {},
+	"it": {}, "me": {}, "of": {}, "on": {}, "or": {}, "s": {}, "she": {}, "tell": {},
+	"that": {}, "the": {}, "their": {}, "there": {}, "they": {}, "this": {}, "to": {},
+	"was": {}, "what": {}, "when": {}, "where": {}, "which": {}, "who": {}, "why": {},
+	"with": {}, "you": {}, "your": {},
+}
+
+// terms splits text into lowercase words, dropping stopwords.
+func terms(text string) []string {
+	words := wordRegex.FindAllString(strings.ToLower(text), -1)
+	out := make([]string, 0, len(words))
+	for _, w := range words {
+		if _, ok := stopwords[w]; ok {
+			continue
+		}
+		out = append(out, w)
+	}
+	return out
+}
+
+// termSet returns the distinct terms in text.
+func termSet(text string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, t := range terms(text) {
+		set[t] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,278 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/jcserv/portfolio-api/internal/utils/log"
+	"github.com/pkg/errors"
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+const (
+	ToolListProjects  = "list_projects"
+	ToolGetExperience = "get_experience"
+	ToolCountRoles    = "count_roles"
+)
+
+// tools describe the structured portfolio data to the chat model, so
+// questions that need complete lists or counts are not answered from a
+// handful of retrieved documents.
+var tools = []openai.Tool{
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        ToolListProjects,
+			Description: "Lists every project in the portfolio, optionally only those built with a technology.",
+			Parameters: jsonschema.Definition{
+				Type: jsonschema.Object,
+				Properties: map[string]jsonschema.Definition{
+					"tech": {
+						Type:        jsonschema.String,
+						Description: "Only list projects built with this technology, e.g. TypeScript. Omit to list every project.",
+					},
+				},
+			},
+		},
+	},
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        ToolGetExperience,
+			Description: "Gets the roles held at a workplace, with their position, duration, technologies and responsibilities.",
+			Parameters: jsonschema.Definition{
+				Type: jsonschema.Object,
+				Properties: map[string]jsonschema.Definition{
+					"workplace": {
+						Type:        jsonschema.String,
+						Description: "The name of the workplace, e.g. SailPoint. Omit to get every role.",
+					},
+				},
+			},
+		},
+	},
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        ToolCountRoles,
+			Description: "Counts the roles in the work experience, in total, by position and how many were internships.",
+			Parameters: jsonschema.Definition{
+				Type:       jsonschema.Object,
+				Properties: map[string]jsonschema.Definition{},
+			},
+		},
+	},
+}
+
+// toolIntentRegex matches questions asking for counts or complete lists,
+// which the tools answer even when no document is relevant.
+var toolIntentRegex = regexp.MustCompile(`(?i)\b(how many|number of|count|list|all|every|each)\b`)
+
+// usesTools reports whether the chat model is offered tools.
+func (s *Service) usesTools() bool {
+	return s.cfg.ToolCalling && s.chat.Capabilities().Tools && (len(s.experiences) > 0 || len(s.projects) > 0)
+}
+
+// needsTools reports whether a question that no document is relevant to may
+// still be answered with tools: it asks for a count or a list, or mentions a
+// category, tech tag or workplace.
+func (s *Service) needsTools(question string) bool {
+	if !s.usesTools() {
+		return false
+	}
+	return toolIntentRegex.MatchString(question) || !s.detectFilter(question).IsZero()
+}
+
+// toolRequest offers the tools on a completion request. Once the chat model
+// has made MaxToolIterations rounds of tool calls, it must answer with what
+// it has.
+func (s *Service) toolRequest(request openai.ChatCompletionRequest, iteration int) openai.ChatCompletionRequest {
+	if !s.usesTools() {
+		return request
+	}
+	request.Tools = tools
+	if iteration >= s.cfg.MaxToolIterations {
+		request.ToolChoice = "none"
+	}
+	return request
+}
+
+// completeWithTools runs a completion, executing the tool calls the chat
+// model makes until it answers. The tool calls and their results are appended
+// to request.Messages.
+func (s *Service) completeWithTools(ctx context.Context, request *openai.ChatCompletionRequest) (string, error) {
+	for iteration := 0; ; iteration++ {
+		completion, err := s.chat.CreateChatCompletion(ctx, s.toolRequest(*request, iteration))
+		if err != nil {
+			return "", err
+		}
+		message, err := firstMessage(completion)
+		if err != nil {
+			return "", err
+		}
+		if len(message.ToolCalls) == 0 || iteration >= s.cfg.MaxToolIterations {
+			return message.Content, nil
+		}
+		request.Messages = append(request.Messages, s.callTools(ctx, message)...)
+	}
+}
+
+// callTools executes the tool calls in an assistant message, returning the
+// message followed by a result message for each call.
+func (s *Service) callTools(ctx context.Context, message openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	messages := []openai.ChatCompletionMessage{{
+		Role:      openai.ChatMessageRoleAssistant,
+		Content:   message.Content,
+		ToolCalls: message.ToolCalls,
+	}}
+	for _, call := range message.ToolCalls {
+		result, err := s.callTool(call.Function.Name, call.Function.Arguments)
+		if err != nil {
+			log.Error(ctx, fmt.Sprintf("tool call: %s(%s) failed: %v", call.Function.Name, call.Function.Arguments, err))
+			result = fmt.Sprintf(`{"error": %q}`, err.Error())
+		} else {
+			log.Info(ctx, fmt.Sprintf("called tool: %s(%s)", call.Function.Name, call.Function.Arguments))
+		}
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:       openai.ChatMessageRoleTool,
+			Content:    result,
+			Name:       call.Function.Name,
+			ToolCallID: call.ID,
+		})
+	}
+	return messages
+}
+
+// callTool runs a tool with the arguments given by the chat model, returning
+// its result as JSON.
+func (s *Service) callTool(name, arguments string) (string, error) {
+	var args struct {
+		Tech      string `json:"tech"`
+		Workplace string `json:"workplace"`
+	}
+	if strings.TrimSpace(arguments) != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return "", errors.Wrap(err, "failed to parse arguments")
+		}
+	}
+
+	var result any
+	switch name {
+	case ToolListProjects:
+		result = s.listProjects(args.Tech)
+	case ToolGetExperience:
+		result = s.getExperience(args.Workplace)
+	case ToolCountRoles:
+		result = s.countRoles()
+	default:
+		return "", fmt.Errorf("unknown tool: %s", name)
+	}
+
+	content, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+type projectResult struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tech        []string `json:"tech"`
+	Links       []string `json:"links"`
+}
+
+func (s *Service) listProjects(tech string) map[string]any {
+	projects := []projectResult{}
+	for _, p := range s.projects {
+		if tech != "" && !containsFold(p.Tech, tech) {
+			continue
+		}
+		links := make([]string, 0, len(p.Links))
+		for _, l := range p.Links {
+			links = append(links, l.String())
+		}
+		projects = append(projects, projectResult{
+			Name:        p.Name,
+			Description: p.Description,
+			Tech:        p.Tech,
+			Links:       links,
+		})
+	}
+	return map[string]any{"count": len(projects), "projects": projects}
+}
+
+func (s *Service) getExperience(workplace string) map[string]any {
+	roles := []model.Experience{}
+	for _, e := range s.experiences {
+		if workplace != "" && !strings.Contains(strings.ToLower(e.Workplace), strings.ToLower(workplace)) {
+			continue
+		}
+		roles = append(roles, e)
+	}
+	return map[string]any{"count": len(roles), "roles": roles}
+}
+
+func (s *Service) countRoles() map[string]any {
+	byPosition := make(map[string]int)
+	workplaces := make(map[string]struct{})
+	var internships []string
+	for _, e := range s.experiences {
+		byPosition[e.Position]++
+		workplaces[e.Workplace] = struct{}{}
+		if strings.Contains(strings.ToLower(e.Position), "intern") {
+			internships = append(internships, e.Workplace)
+		}
+	}
+	sort.Strings(internships)
+	return map[string]any{
+		"total":       len(s.experiences),
+		"workplaces":  len(workplaces),
+		"internships": map[string]any{"count": len(internships), "workplaces": internships},
+		"by_position": byPosition,
+	}
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// toolCallAccumulator reassembles tool calls from streamed deltas, which
+// split each call's arguments across chunks.
+type toolCallAccumulator struct {
+	calls []openai.ToolCall
+}
+
+func (a *toolCallAccumulator) Add(deltas []openai.ToolCall) {
+	for _, delta := range deltas {
+		i := len(a.calls)
+		if delta.Index != nil {
+			i = *delta.Index
+		}
+		for len(a.calls) <= i {
+			a.calls = append(a.calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
+		call := &a.calls[i]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		call.Function.Name += delta.Function.Name
+		call.Function.Arguments += delta.Function.Arguments
+	}
+}
+
+// Calls returns the tool calls streamed so far.
+func (a *toolCallAccumulator) Calls() []openai.ToolCall {
+	return a.calls
+}
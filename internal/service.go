@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"time"
 
-	"github.com/jcserv/portfolio-api/internal/api/openai"
 	"github.com/jcserv/portfolio-api/internal/db"
 	"github.com/jcserv/portfolio-api/internal/rag"
 	"github.com/jcserv/portfolio-api/internal/transport/rest"
@@ -15,8 +15,9 @@ import (
 )
 
 type Service struct {
-	api *rest.API
-	cfg *Configuration
+	api        *rest.API
+	cfg        *Configuration
+	ragService *rag.Service
 }
 
 func NewService() (*Service, error) {
@@ -30,14 +31,81 @@ func NewService() (*Service, error) {
 		return nil, err
 	}
 
-	openAIClient := openai.NewClient(cfg.OpenAIKey)
+	embedder, chat, err := NewProviders(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	reranker, err := rag.NewReranker(cfg.Reranker, chat)
+	if err != nil {
+		return nil, err
+	}
+
+	guardrails, err := rag.NewGuardrails(rag.GuardrailConfig{
+		Moderation:        cfg.Moderation,
+		RedactContactInfo: cfg.RedactContactInfo,
+		ContactAllowlist:  cfg.ContactAllowlist,
+		MaxAnswerLength:   cfg.MaxAnswerLength,
+	}, chat)
+	if err != nil {
+		return nil, err
+	}
+
+	prompt, err := rag.LoadPromptTemplate(cfg.PromptTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	curatedSuggestions, err := utils.ReadSuggestions()
+	if err != nil {
+		return nil, err
+	}
 
-	ragEmbedder := rag.NewEmbedder(openAIClient)
-	ragService := rag.NewService(db, ragEmbedder)
+	ragService := rag.NewService(db, embedder, chat, reranker, guardrails, rag.Config{
+		ConversationTTL:           cfg.ConversationTTL,
+		ConversationHistoryLimit:  cfg.ConversationHistoryLimit,
+		RetrievalMode:             cfg.RetrievalMode,
+		LexicalWeight:             cfg.LexicalWeight,
+		RRFK:                      cfg.RRFK,
+		MMR:                       cfg.MMR,
+		MMRLambda:                 cfg.MMRLambda,
+		RerankCandidates:          cfg.RerankCandidates,
+		QueryRewrite:              cfg.QueryRewrite,
+		QueryHyDE:                 cfg.QueryHyDE,
+		QueryExpansions:           cfg.QueryExpansions,
+		AnswerCache:               cfg.AnswerCache,
+		AnswerCacheThreshold:      cfg.AnswerCacheThreshold,
+		MinSimilarity:             cfg.MinSimilarity,
+		OutOfScopeResponse:        cfg.OutOfScopeResponse,
+		ChatModel:                 cfg.ChatModel,
+		AllowedChatModels:         cfg.AllowedChatModels,
+		TopK:                      cfg.TopK,
+		MaxTopK:                   cfg.MaxTopK,
+		Temperature:               float32(cfg.Temperature),
+		MaxTokens:                 cfg.MaxTokens,
+		MaxCompletionTokens:       cfg.MaxCompletionTokens,
+		OwnerName:                 cfg.OwnerName,
+		Prompt:                    prompt,
+		InjectionDetection:        cfg.InjectionDetection,
+		InjectionClassifier:       cfg.InjectionClassifier,
+		InjectionAction:           cfg.InjectionAction,
+		GuardrailFallbackResponse: cfg.GuardrailFallbackResponse,
+		ContextTokenBudget:        cfg.ContextTokenBudget,
+		StructuredAnswers:         cfg.StructuredAnswers,
+		StructuredAnswerRetries:   cfg.StructuredAnswerRetries,
+		CuratedSuggestions:        curatedSuggestions,
+		SuggestionCount:           cfg.SuggestionCount,
+		ToolCalling:               cfg.ToolCalling,
+		MaxToolIterations:         cfg.MaxToolIterations,
+		LanguageDetection:         cfg.LanguageDetection,
+		QueryTranslation:          cfg.QueryTranslation,
+		FilterDetection:           cfg.FilterDetection,
+	})
 
 	s := &Service{
-		api: rest.NewAPI(ragService),
-		cfg: cfg,
+		api:        rest.NewAPI(ragService, cfg.AdminToken),
+		cfg:        cfg,
+		ragService: ragService,
 	}
 
 	err = s.Init(ragService)
@@ -49,27 +117,38 @@ func NewService() (*Service, error) {
 }
 
 func (s *Service) Init(ragService *rag.Service) error {
+	if err := ragService.EnsureEmbeddingModel(context.Background()); err != nil {
+		log.Error(context.Background(), fmt.Sprintf("unable to check embedding model: %v", err))
+		return err
+	}
+
 	exp, err := utils.ReadExperience()
 	if err != nil {
 		log.Error(context.Background(), fmt.Sprintf("unable to read experience: %v", err))
 		return err
 	}
 
-	err = ragService.IndexExperience(context.Background(), exp)
+	projs, err := utils.ReadProjects()
 	if err != nil {
-		log.Error(context.Background(), fmt.Sprintf("unable to index experience: %v", err))
+		log.Error(context.Background(), fmt.Sprintf("unable to read projects: %v", err))
 		return err
 	}
 
-	projs, err := utils.ReadProjects()
+	_, err = ragService.IndexCorpus(context.Background(), exp, projs)
 	if err != nil {
-		log.Error(context.Background(), fmt.Sprintf("unable to read projects: %v", err))
+		log.Error(context.Background(), fmt.Sprintf("unable to index corpus: %v", err))
+		return err
+	}
+
+	err = ragService.UpdateCorpusVersion(context.Background())
+	if err != nil {
+		log.Error(context.Background(), fmt.Sprintf("unable to update corpus version: %v", err))
 		return err
 	}
 
-	err = ragService.IndexProjects(context.Background(), projs)
+	err = ragService.UpdateSuggestions(context.Background())
 	if err != nil {
-		log.Error(context.Background(), fmt.Sprintf("unable to index projects: %v", err))
+		log.Error(context.Background(), fmt.Sprintf("unable to update suggestions: %v", err))
 		return err
 	}
 	return nil
@@ -86,6 +165,8 @@ func (s *Service) Run() error {
 		s.StartHTTP(ctx)
 	}(ctx)
 
+	go s.StartConversationJanitor(ctx)
+
 	wg.Wait()
 	return nil
 }
@@ -96,3 +177,29 @@ func (s *Service) StartHTTP(ctx context.Context) error {
 	http.ListenAndServe(fmt.Sprintf(":%s", s.cfg.HTTPPort), r)
 	return nil
 }
+
+// StartConversationJanitor periodically deletes expired conversations until ctx
+// is cancelled.
+func (s *Service) StartConversationJanitor(ctx context.Context) {
+	interval := s.cfg.ConversationTTL / 4
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.ragService.ExpireConversations(ctx); err != nil {
+				log.Error(ctx, fmt.Sprintf("unable to expire conversations: %v", err))
+			}
+		}
+	}
+}
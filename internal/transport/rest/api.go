@@ -17,9 +17,9 @@ type API struct {
 	V1API *v1.API
 }
 
-func NewAPI(ragService *rag.Service) *API {
+func NewAPI(ragService *rag.Service, adminToken string) *API {
 	return &API{
-		V1API: v1.NewAPI(ragService),
+		V1API: v1.NewAPI(ragService, adminToken),
 	}
 }
 
@@ -11,6 +11,7 @@ import (
 type HTTPError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	Reason  string `json:"reason,omitempty"`
 }
 
 func NewHTTPError(code int, message string) *HTTPError {
@@ -24,14 +25,34 @@ func BadRequest(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusBadRequest)
 }
 
+func BadRequestWithMessage(w http.ResponseWriter, message string) {
+	w.WriteHeader(http.StatusBadRequest)
+	writeResponse(w, NewHTTPError(http.StatusBadRequest, message))
+}
+
+func BadRequestWithReason(w http.ResponseWriter, message, reason string) {
+	w.WriteHeader(http.StatusBadRequest)
+	httpErr := NewHTTPError(http.StatusBadRequest, message)
+	httpErr.Reason = reason
+	writeResponse(w, httpErr)
+}
+
+func Unauthorized(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
 func NotFound(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusNotFound)
 }
 
+// InternalServerErrorMessage is returned in place of internal errors, which
+// are only logged, since they can hold details of upstream services.
+const InternalServerErrorMessage = "something went wrong, please try again later"
+
 func InternalServerError(ctx context.Context, w http.ResponseWriter, err error) {
 	log.Error(ctx, err.Error())
 	w.WriteHeader(http.StatusInternalServerError)
-	writeResponse(w, NewHTTPError(http.StatusInternalServerError, err.Error()))
+	writeResponse(w, NewHTTPError(http.StatusInternalServerError, InternalServerErrorMessage))
 }
 
 func PermanentRedirect(w http.ResponseWriter, url string) {
@@ -0,0 +1,47 @@
+package httputil
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PreferredLanguage returns the primary language code of the most preferred
+// language in the request's Accept-Language header, e.g. "fr" for
+// "fr-CA,fr;q=0.9,en;q=0.8", or an empty string if there is none.
+func PreferredLanguage(r *http.Request) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if !isLanguageCode(primary) || q <= bestQ {
+			continue
+		}
+		best, bestQ = primary, q
+	}
+	return best
+}
+
+// isLanguageCode reports whether s is an ISO 639 language code, which also
+// rules out the "*" wildcard.
+func isLanguageCode(s string) bool {
+	if len(s) < 2 || len(s) > 3 {
+		return false
+	}
+	for _, r := range s {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
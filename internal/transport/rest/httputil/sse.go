@@ -0,0 +1,44 @@
+package httputil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var ErrStreamingUnsupported = errors.New("streaming unsupported")
+
+// EventStream writes Server-Sent Events to a response.
+type EventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func NewEventStream(w http.ResponseWriter) (*EventStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &EventStream{w: w, flusher: flusher}, nil
+}
+
+func (s *EventStream) Send(event string, data any) error {
+	obj, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, obj); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
@@ -2,21 +2,137 @@ package v1
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/jcserv/portfolio-api/internal/rag"
 	"github.com/jcserv/portfolio-api/internal/transport/rest/httputil"
 	"github.com/jcserv/portfolio-api/internal/utils/log"
 )
 
 type AskRequest struct {
-	Question string `json:"question"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	Question       string `json:"question"`
+
+	// Optional overrides, validated against the server's limits
+	TopK      int    `json:"top_k,omitempty"`
+	MaxTokens int    `json:"max_tokens,omitempty"`
+	Model     string `json:"model,omitempty"`
+
+	// Optional filters on the documents searched. Category is "experience"
+	// or "project", and documents must be tagged with every tech
+	Category  string   `json:"category,omitempty"`
+	Tech      []string `json:"tech,omitempty"`
+	Workplace string   `json:"workplace,omitempty"`
 }
 
 type AskResponse struct {
-	Answer string `json:"answer"`
+	ConversationID string `json:"conversation_id"`
+	// AnswerID identifies the answer when giving feedback on it
+	AnswerID string `json:"answer_id,omitempty"`
+	// Answer is formatted as markdown
+	Answer            string   `json:"answer"`
+	FollowUpQuestions []string `json:"follow_up_questions"`
+	Entities          []Entity `json:"entities"`
+	Sources           []Source `json:"sources"`
+	Cached            bool     `json:"cached"`
+	OutOfScope        bool     `json:"out_of_scope"`
+	PromptVersion     string   `json:"prompt_version,omitempty"`
+	// Language is the code of the language the answer is written in, which
+	// is detected from the question unless set by Accept-Language
+	Language string `json:"language"`
+	// GuardrailFallback is set when the answer was replaced with a safe
+	// response after failing a guardrail
+	GuardrailFallback bool `json:"guardrail_fallback"`
+}
+
+// Entity is an employer or project mentioned in the answer.
+type Entity struct {
+	Name string `json:"name"`
+	// Type is "employer" or "project"
+	Type string `json:"type"`
+}
+
+type Source struct {
+	ID       int64   `json:"id"`
+	Category string  `json:"category"`
+	Title    string  `json:"title"`
+	Score    float64 `json:"score"`
+
+	RerankScore *float64 `json:"rerank_score,omitempty"`
+}
+
+// toRAG converts the request, answering in language if it is set.
+func (r AskRequest) toRAG(language string) rag.Request {
+	return rag.Request{
+		ConversationID: r.ConversationID,
+		Question:       r.Question,
+		Language:       language,
+		Options: rag.GenerationOptions{
+			TopK:      r.TopK,
+			MaxTokens: r.MaxTokens,
+			Model:     r.Model,
+		},
+		Filter: model.SearchFilter{
+			Category:  r.Category,
+			Tech:      r.Tech,
+			Workplace: r.Workplace,
+		},
+	}
+}
+
+func newAskResponse(resp *rag.Response) AskResponse {
+	sources := make([]Source, 0, len(resp.Sources))
+	for _, s := range resp.Sources {
+		sources = append(sources, Source{
+			ID:       s.ID,
+			Category: s.Category,
+			Title:    s.Title,
+			Score:    s.Score,
+
+			RerankScore: s.RerankScore,
+		})
+	}
+	followUps := resp.FollowUpQuestions
+	if followUps == nil {
+		followUps = []string{}
+	}
+	entities := make([]Entity, 0, len(resp.Entities))
+	for _, e := range resp.Entities {
+		entities = append(entities, Entity{Name: e.Name, Type: e.Type})
+	}
+	return AskResponse{
+		ConversationID:    resp.ConversationID,
+		AnswerID:          resp.AnswerID,
+		Answer:            resp.Answer,
+		FollowUpQuestions: followUps,
+		Entities:          entities,
+		Sources:           sources,
+		Cached:            resp.Cached,
+		OutOfScope:        resp.OutOfScope,
+		PromptVersion:     resp.PromptVersion,
+		Language:          resp.Language,
+
+		GuardrailFallback: resp.GuardrailFallback,
+	}
+}
+
+type AskStreamToken struct {
+	Token string `json:"token"`
 }
 
+type AskStreamError struct {
+	Message string `json:"message"`
+}
+
+const (
+	EventToken = "token"
+	EventDone  = "done"
+	EventError = "error"
+)
+
 func (a *API) Ask() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -33,13 +149,80 @@ func (a *API) Ask() http.HandlerFunc {
 			return
 		}
 
-		answer, err := a.ragService.Answer(ctx, req.Question)
+		resp, err := a.ragService.Answer(ctx, req.toRAG(httputil.PreferredLanguage(r)))
+		if writeRejection(w, err) {
+			return
+		}
 		if err != nil {
 			log.Error(ctx, fmt.Sprintf("unable to answer question: %v, err: %v", req.Question, err))
 			httputil.InternalServerError(ctx, w, err)
 			return
 		}
-		log.Info(ctx, fmt.Sprintf("answered question: %s with answer: %s", req.Question, answer))
-		httputil.OK(w, AskResponse{Answer: answer})
+		log.Info(ctx, fmt.Sprintf("answered question: %s (answer id: %s, prompt version: %s)", req.Question, resp.AnswerID, resp.PromptVersion))
+		httputil.OK(w, newAskResponse(resp))
+	}
+}
+
+func (a *API) AskStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req AskRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Error(ctx, fmt.Sprintf("unable to decode request body: %v", err))
+			httputil.BadRequest(w)
+			return
+		}
+
+		if req.Question == "" {
+			httputil.BadRequest(w)
+			return
+		}
+
+		ragReq, err := a.ragService.Validate(ctx, req.toRAG(httputil.PreferredLanguage(r)))
+		if writeRejection(w, err) {
+			return
+		}
+		if err != nil {
+			httputil.InternalServerError(ctx, w, err)
+			return
+		}
+
+		stream, err := httputil.NewEventStream(w)
+		if err != nil {
+			httputil.InternalServerError(ctx, w, err)
+			return
+		}
+
+		resp, err := a.ragService.AnswerStream(ctx, ragReq, func(delta string) error {
+			return stream.Send(EventToken, AskStreamToken{Token: delta})
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Info(ctx, fmt.Sprintf("client disconnected while streaming answer to question: %s", req.Question))
+				return
+			}
+			log.Error(ctx, fmt.Sprintf("unable to stream answer to question: %v, err: %v", req.Question, err))
+			stream.Send(EventError, AskStreamError{Message: httputil.InternalServerErrorMessage})
+			return
+		}
+		log.Info(ctx, fmt.Sprintf("streamed answer to question: %s (answer id: %s, prompt version: %s)", req.Question, resp.AnswerID, resp.PromptVersion))
+		stream.Send(EventDone, newAskResponse(resp))
+	}
+}
+
+// writeRejection responds with a 400 if err is the service rejecting the
+// request, reporting whether it did.
+func writeRejection(w http.ResponseWriter, err error) bool {
+	var invalid *rag.InvalidRequestError
+	if errors.As(err, &invalid) {
+		httputil.BadRequestWithMessage(w, invalid.Reason)
+		return true
+	}
+	var injection *rag.InjectionError
+	if errors.As(err, &injection) {
+		httputil.BadRequestWithReason(w, "question was flagged as a prompt injection attempt", injection.Reason)
+		return true
 	}
+	return false
 }
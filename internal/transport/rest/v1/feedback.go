@@ -0,0 +1,158 @@
+package v1
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jcserv/portfolio-api/internal/model"
+	"github.com/jcserv/portfolio-api/internal/rag"
+	"github.com/jcserv/portfolio-api/internal/transport/rest/httputil"
+	"github.com/jcserv/portfolio-api/internal/utils/log"
+)
+
+const (
+	defaultFeedbackLimit = 50
+	maxFeedbackLimit     = 500
+)
+
+type FeedbackRequest struct {
+	AnswerID string `json:"answer_id"`
+	// Rating is "up" or "down"
+	Rating  string `json:"rating"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type FeedbackListResponse struct {
+	Feedback []Feedback `json:"feedback"`
+}
+
+// Feedback is a rating along with the answer it rates.
+type Feedback struct {
+	ID             int64     `json:"id"`
+	Rating         string    `json:"rating"`
+	Comment        string    `json:"comment"`
+	CreatedAt      time.Time `json:"created_at"`
+	AnswerID       string    `json:"answer_id"`
+	ConversationID string    `json:"conversation_id"`
+	Question       string    `json:"question"`
+	Answer         string    `json:"answer"`
+	Sources        []Source  `json:"sources"`
+	PromptVersion  string    `json:"prompt_version"`
+}
+
+func newFeedback(f model.Feedback) Feedback {
+	sources := make([]Source, 0, len(f.Answer.Sources))
+	for _, s := range f.Answer.Sources {
+		sources = append(sources, Source{
+			ID:       s.ID,
+			Category: s.Category,
+			Title:    s.Title,
+			Score:    s.Score,
+
+			RerankScore: s.RerankScore,
+		})
+	}
+	return Feedback{
+		ID:             f.ID,
+		Rating:         f.Rating,
+		Comment:        f.Comment,
+		CreatedAt:      f.CreatedAt,
+		AnswerID:       f.Answer.ID,
+		ConversationID: f.Answer.ConversationID,
+		Question:       f.Answer.Question,
+		Answer:         f.Answer.Answer,
+		Sources:        sources,
+		PromptVersion:  f.Answer.PromptVersion,
+	}
+}
+
+func (a *API) Feedback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req FeedbackRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Error(ctx, fmt.Sprintf("unable to decode request body: %v", err))
+			httputil.BadRequest(w)
+			return
+		}
+
+		if req.AnswerID == "" {
+			httputil.BadRequestWithMessage(w, "answer_id is required")
+			return
+		}
+
+		err := a.ragService.SubmitFeedback(ctx, req.AnswerID, req.Rating, strings.TrimSpace(req.Comment))
+		if writeRejection(w, err) {
+			return
+		}
+		if errors.Is(err, rag.ErrAnswerNotFound) {
+			httputil.NotFound(w)
+			return
+		}
+		if err != nil {
+			httputil.InternalServerError(ctx, w, err)
+			return
+		}
+		httputil.OK(w, nil)
+	}
+}
+
+// ListFeedback lists the most recent feedback with the answers it rates,
+// negative feedback unless the rating query parameter says otherwise.
+func (a *API) ListFeedback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		rating := r.URL.Query().Get("rating")
+		if rating == "" {
+			rating = model.RatingDown
+		}
+
+		limit := defaultFeedbackLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil || parsed < 1 || parsed > maxFeedbackLimit {
+				httputil.BadRequestWithMessage(w, fmt.Sprintf("limit must be between 1 and %d", maxFeedbackLimit))
+				return
+			}
+			limit = parsed
+		}
+
+		feedback, err := a.ragService.ListFeedback(ctx, rating, limit)
+		if writeRejection(w, err) {
+			return
+		}
+		if err != nil {
+			httputil.InternalServerError(ctx, w, err)
+			return
+		}
+
+		resp := FeedbackListResponse{Feedback: make([]Feedback, 0, len(feedback))}
+		for _, f := range feedback {
+			resp.Feedback = append(resp.Feedback, newFeedback(f))
+		}
+		httputil.OK(w, resp)
+	}
+}
+
+// requireAdminToken only lets through requests bearing the admin token.
+func requireAdminToken(token string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+				httputil.Unauthorized(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
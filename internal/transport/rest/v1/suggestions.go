@@ -0,0 +1,38 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jcserv/portfolio-api/internal/transport/rest/httputil"
+	"github.com/jcserv/portfolio-api/internal/utils/log"
+)
+
+type SuggestionsResponse struct {
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+type Suggestion struct {
+	Question string `json:"question"`
+	// Source is "curated" or "generated"
+	Source string `json:"source"`
+}
+
+func (a *API) Suggestions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		suggestions, err := a.ragService.Suggestions(ctx)
+		if err != nil {
+			log.Error(ctx, fmt.Sprintf("unable to get suggestions: %v", err))
+			httputil.InternalServerError(ctx, w, err)
+			return
+		}
+
+		resp := SuggestionsResponse{Suggestions: make([]Suggestion, 0, len(suggestions))}
+		for _, s := range suggestions {
+			resp.Suggestions = append(resp.Suggestions, Suggestion{Question: s.Question, Source: s.Source})
+		}
+		httputil.OK(w, resp)
+	}
+}
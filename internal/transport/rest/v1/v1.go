@@ -13,12 +13,23 @@ const (
 
 type API struct {
 	ragService *rag.Service
+	// adminToken guards the admin endpoints, which are disabled if it is empty
+	adminToken string
 }
 
-func NewAPI(ragService *rag.Service) *API {
-	return &API{ragService: ragService}
+func NewAPI(ragService *rag.Service, adminToken string) *API {
+	return &API{ragService: ragService, adminToken: adminToken}
 }
 
 func (a *API) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc(APIV1URLPath+"ask", a.Ask()).Methods(http.MethodPost)
+	r.HandleFunc(APIV1URLPath+"ask/stream", a.AskStream()).Methods(http.MethodPost)
+	r.HandleFunc(APIV1URLPath+"suggestions", a.Suggestions()).Methods(http.MethodGet)
+	r.HandleFunc(APIV1URLPath+"feedback", a.Feedback()).Methods(http.MethodPost)
+
+	if a.adminToken != "" {
+		admin := r.PathPrefix(APIV1URLPath + "admin/").Subrouter()
+		admin.Use(requireAdminToken(a.adminToken))
+		admin.HandleFunc("/feedback", a.ListFeedback()).Methods(http.MethodGet)
+	}
 }
@@ -2,13 +2,22 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 
 	"github.com/jcserv/portfolio-api/internal/model"
 )
 
+// The corpus files, which also name the source of each indexed document, and
+// the curated starter questions.
+const (
+	ExperienceFile  = "dist/experience.json"
+	ProjectsFile    = "dist/projects.json"
+	SuggestionsFile = "dist/suggestions.json"
+)
+
 func ReadExperience() ([]model.Experience, error) {
-	file, err := os.Open("dist/experience.json")
+	file, err := os.Open(ExperienceFile)
 	if err != nil {
 		return nil, err
 	}
@@ -22,7 +31,7 @@ func ReadExperience() ([]model.Experience, error) {
 }
 
 func ReadProjects() ([]model.Project, error) {
-	file, err := os.Open("dist/projects.json")
+	file, err := os.Open(ProjectsFile)
 	if err != nil {
 		return nil, err
 	}
@@ -34,3 +43,22 @@ func ReadProjects() ([]model.Project, error) {
 	}
 	return projects, nil
 }
+
+// ReadSuggestions returns the curated starter questions, or none if there is
+// no suggestions file.
+func ReadSuggestions() ([]string, error) {
+	file, err := os.Open(SuggestionsFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var suggestions []string
+	if err := json.NewDecoder(file).Decode(&suggestions); err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
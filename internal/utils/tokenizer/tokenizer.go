@@ -0,0 +1,113 @@
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	CL100KBase = tiktoken.MODEL_CL100K_BASE
+	O200KBase  = tiktoken.MODEL_O200K_BASE
+)
+
+// Per-message overhead of the chat format, from OpenAI's guide to counting
+// tokens: each message is wrapped in role and separator tokens, and every
+// reply is primed with the assistant role.
+const (
+	tokensPerMessage = 3
+	tokensPerName    = 1
+	tokensPerReply   = 3
+)
+
+// o200kPrefixes are the model families that use o200k_base. Every other
+// model, including non-OpenAI ones, is counted with cl100k_base, which is
+// close enough for budgeting.
+var o200kPrefixes = []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "o1", "o3", "o4", "chatgpt-4o"}
+
+var (
+	mu        sync.Mutex
+	encodings = make(map[string]*Tokenizer)
+)
+
+func init() {
+	// Load BPE ranks from files embedded in the binary instead of
+	// downloading them at runtime
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// Tokenizer counts tokens with a BPE encoding.
+type Tokenizer struct {
+	encoding string
+	bpe      *tiktoken.Tiktoken
+}
+
+// New returns the tokenizer for an encoding, cl100k_base or o200k_base.
+// Tokenizers are cached, as building one takes a while.
+func New(encoding string) (*Tokenizer, error) {
+	if encoding != CL100KBase && encoding != O200KBase {
+		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if t, ok := encodings[encoding]; ok {
+		return t, nil
+	}
+
+	bpe, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, fmt.Errorf("loading encoding %s: %w", encoding, err)
+	}
+	t := &Tokenizer{encoding: encoding, bpe: bpe}
+	encodings[encoding] = t
+	return t, nil
+}
+
+// ForModel returns the tokenizer for a model.
+func ForModel(model string) (*Tokenizer, error) {
+	return New(EncodingForModel(model))
+}
+
+// EncodingForModel returns the name of the encoding a model uses.
+func EncodingForModel(model string) string {
+	model = strings.ToLower(model)
+	for _, prefix := range o200kPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return O200KBase
+		}
+	}
+	return CL100KBase
+}
+
+func (t *Tokenizer) Encoding() string {
+	return t.encoding
+}
+
+// Count returns the number of tokens in text. Special tokens are counted as
+// ordinary text.
+func (t *Tokenizer) Count(text string) int {
+	return len(t.bpe.EncodeOrdinary(text))
+}
+
+// CountMessages returns the number of prompt tokens a chat completion request
+// with messages uses, including the formatting around each message.
+func (t *Tokenizer) CountMessages(messages []openai.ChatCompletionMessage) int {
+	tokens := tokensPerReply
+	for _, msg := range messages {
+		tokens += tokensPerMessage
+		tokens += t.Count(msg.Role)
+		tokens += t.Count(msg.Content)
+		for _, part := range msg.MultiContent {
+			tokens += t.Count(part.Text)
+		}
+		if msg.Name != "" {
+			tokens += tokensPerName + t.Count(msg.Name)
+		}
+	}
+	return tokens
+}